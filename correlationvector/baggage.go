@@ -0,0 +1,50 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// BaggageKey is the key of the W3C baggage member carrying the correlation
+// vector, for services propagating it alongside OpenTelemetry.
+const BaggageKey string = "mscv"
+
+// BaggageMember gets the value of the correlation vector as a W3C baggage
+// member, "mscv=" followed by the value percent-encoded, such as the "+" and "/"
+// a base may contain, to be added to the list of the baggage header. Like
+// Value, it does not increment the correlation vector. An error is returned
+// when the correlation vector is not valid, since peers would reject it.
+func (cv *CorrelationVector) BaggageMember() (string, error) {
+	if !cv.Valid() {
+		return "", errors.New("correlationvector: invalid correlation vector for baggage")
+	}
+	return BaggageKey + "=" + url.QueryEscape(cv.Value()), nil
+}
+
+// FromBaggage creates a new correlation vector by extending the value of the
+// "mscv" member found in the baggage header, like FromHeader. The value is
+// percent-decoded and any property of the member is ignored. An error is
+// returned when the member is missing or invalid.
+func FromBaggage(header string) (*CorrelationVector, error) {
+	for _, member := range strings.Split(header, ",") {
+		member, _, _ = strings.Cut(member, ";")
+		key, value, ok := strings.Cut(member, "=")
+		if !ok || strings.TrimSpace(key) != BaggageKey {
+			continue
+		}
+
+		value, err := url.PathUnescape(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("correlationvector: invalid %s baggage member: %w", BaggageKey, err)
+		}
+		return extendHeader(value)
+	}
+
+	return nil, errors.New("correlationvector: missing " + BaggageKey + " baggage member")
+}
@@ -0,0 +1,39 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"testing"
+)
+
+func TestBaggageRoundTrip(t *testing.T) {
+	vector, _ := Parse("KZY+dsX2jEaZ/sgCPjJ2Ng.1")
+	member, err := vector.BaggageMember()
+	if err != nil || member != "mscv=KZY%2BdsX2jEaZ%2FsgCPjJ2Ng.1" {
+		t.Errorf("Baggage member should be mscv=KZY%%2BdsX2jEaZ%%2FsgCPjJ2Ng.1, got %s (%v)", member, err)
+	}
+
+	for _, header := range []string{
+		"userId=alice, " + member + ";ttl=5, isProduction=false",
+		"mscv = KZY+dsX2jEaZ/sgCPjJ2Ng.1",
+	} {
+		vector, err := FromBaggage(header)
+		if err != nil || vector.Value() != "KZY+dsX2jEaZ/sgCPjJ2Ng.1.0" {
+			t.Errorf("Vector from baggage %s should be KZY+dsX2jEaZ/sgCPjJ2Ng.1.0, got %v", header, err)
+		}
+	}
+}
+
+func TestFromBaggageInvalid(t *testing.T) {
+	for _, header := range []string{"", "userId=alice", "mscv=tul4NUsfs9Cl7mOf.x", "mscv=tul4%ZZ"} {
+		if _, err := FromBaggage(header); err == nil {
+			t.Errorf("Vector from baggage %q should return error", header)
+		}
+	}
+
+	if _, err := newCorrelationVector("tul4NUsfs9Cl7mO", 1, V1Version, false).BaggageMember(); err == nil {
+		t.Errorf("Baggage member of an invalid cv should return error")
+	}
+}
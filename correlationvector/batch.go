@@ -0,0 +1,96 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"bufio"
+	"io"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// parallelParseThreshold is the number of values from which ParseMany spreads
+// the work across goroutines.
+const parallelParseThreshold = 1024
+
+// ParseMany parses every value like Parse, returning the correlation vectors
+// and the errors at the same index as their value. Large batches are split
+// across at most GOMAXPROCS goroutines.
+func ParseMany(values []string) ([]*CorrelationVector, []error) {
+	vectors := make([]*CorrelationVector, len(values))
+	errs := make([]error, len(values))
+
+	workers := runtime.GOMAXPROCS(0)
+	if len(values) < parallelParseThreshold || workers == 1 {
+		parseRange(values, vectors, errs, 0, len(values))
+		return vectors, errs
+	}
+
+	var wg sync.WaitGroup
+	chunk := (len(values) + workers - 1) / workers
+	for start := 0; start < len(values); start += chunk {
+		end := start + chunk
+		if end > len(values) {
+			end = len(values)
+		}
+
+		wg.Add(1)
+		go func(start, end int) {
+			defer wg.Done()
+			parseRange(values, vectors, errs, start, end)
+		}(start, end)
+	}
+	wg.Wait()
+
+	return vectors, errs
+}
+
+// Partition parses every value like ParseMany and sorts them into the valid
+// correlation vectors and the invalid values, each in their input order. When
+// ValidateCorrelationVectorDuringCreation is set, the correlation vectors must
+// also pass validation, including the checks of ValidateStrict, to be valid.
+func Partition(values []string) (valid []*CorrelationVector, invalid []string) {
+	vectors, errs := ParseMany(values)
+	for i, cv := range vectors {
+		err := errs[i]
+		if err == nil && ValidateCorrelationVectorDuringCreation {
+			err = validate(cv.Unsealed(), cv.version)
+		}
+		if err != nil {
+			invalid = append(invalid, values[i])
+			continue
+		}
+		valid = append(valid, cv)
+	}
+	return valid, invalid
+}
+
+// parseRange Parses the values between start and end into the vectors and errs at the same index.
+func parseRange(values []string, vectors []*CorrelationVector, errs []error, start, end int) {
+	for i := start; i < end; i++ {
+		vectors[i], errs[i] = Parse(values[i])
+	}
+}
+
+// Scan reads newline-delimited correlation vectors from r and calls fn with
+// each one parsed like Parse, so that large inputs are never held in memory.
+// The error of a line that cannot be parsed is passed to fn along with the
+// line's result and the scan goes on; blank lines are skipped. When reading
+// from r fails, or a line exceeds bufio.MaxScanTokenSize, fn is called a last
+// time with a nil correlation vector and the read error.
+func Scan(r io.Reader, fn func(*CorrelationVector, error)) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		fn(Parse(line))
+	}
+	if err := scanner.Err(); err != nil {
+		fn(nil, err)
+	}
+}
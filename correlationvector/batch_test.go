@@ -0,0 +1,122 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func batchValues(n int) []string {
+	values := make([]string, n)
+	for i := range values {
+		switch i % 3 {
+		case 0:
+			values[i] = "tul4NUsfs9Cl7mOf.1." + strconv.Itoa(i)
+		case 1:
+			values[i] = "KZY+dsX2jEaZesgCPjJ2Ng.1." + strconv.Itoa(i)
+		default:
+			values[i] = "tul4NUsfs9Cl7mOf.x"
+		}
+	}
+	return values
+}
+
+func TestParseMany(t *testing.T) {
+	for _, n := range []int{10, parallelParseThreshold * 3} {
+		values := batchValues(n)
+		vectors, errs := ParseMany(values)
+
+		if len(vectors) != n || len(errs) != n {
+			t.Errorf("ParseMany should return %d results, got %d vectors and %d errors", n, len(vectors), len(errs))
+			continue
+		}
+		for i, value := range values {
+			expected, expectedErr := Parse(value)
+			if (expectedErr == nil) != (errs[i] == nil) {
+				t.Errorf("ParseMany of %s should return error %v, got %v", value, expectedErr, errs[i])
+			}
+			if expected != nil && (vectors[i] == nil || vectors[i].Value() != expected.Value()) {
+				t.Errorf("ParseMany of %s should return %s, got %v", value, expected.Value(), vectors[i])
+			}
+		}
+	}
+}
+
+func TestPartition(t *testing.T) {
+	values := []string{"tul4NUsfs9Cl7mOf.1", "tul4NUsfs9Cl7mOf.x", "KZY+dsX2jEaZesgCPjJ2Ng.2!", "tul4NUsfs9Cl7mO.3", "tul4NUsfs9Cl:mOf.4"}
+	valid, invalid := Partition(values)
+	if len(valid) != 3 || valid[0].Value() != values[0] || valid[1].Value() != values[2] ||
+		len(invalid) != 2 || invalid[0] != values[1] || invalid[1] != values[3] {
+		t.Errorf("Partition should split %v into 3 valid and 2 invalid values, got %d and %v", values, len(valid), invalid)
+	}
+
+	ValidateCorrelationVectorDuringCreation = true
+	ValidateStrict = true
+	defer func() {
+		ValidateCorrelationVectorDuringCreation = false
+		ValidateStrict = false
+	}()
+	if valid, invalid := Partition(values); len(valid) != 2 || len(invalid) != 3 || invalid[2] != values[4] {
+		t.Errorf("Partition with strict validation should also reject the invalid base, got %v", invalid)
+	}
+}
+
+func TestScan(t *testing.T) {
+	var values []string
+	var errs int
+	Scan(strings.NewReader("tul4NUsfs9Cl7mOf.1\r\n\ninvalid\nKZY+dsX2jEaZesgCPjJ2Ng.2!\n"), func(vector *CorrelationVector, err error) {
+		if err != nil {
+			errs++
+			return
+		}
+		values = append(values, vector.Value())
+	})
+
+	if strings.Join(values, ",") != "tul4NUsfs9Cl7mOf.1,KZY+dsX2jEaZesgCPjJ2Ng.2!" || errs != 1 {
+		t.Errorf("Scanning should parse every line and report 1 error, got %v and %d errors", values, errs)
+	}
+}
+
+func TestScanReadError(t *testing.T) {
+	var lastErr error
+	Scan(iotest.ErrReader(errors.New("read failed")), func(vector *CorrelationVector, err error) {
+		lastErr = err
+	})
+	if lastErr == nil || lastErr.Error() != "read failed" {
+		t.Errorf("Scanning should report the read error, got %v", lastErr)
+	}
+}
+
+func BenchmarkParseMany(b *testing.B) {
+	values := batchValues(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ParseMany(values)
+	}
+}
+
+func BenchmarkPartition(b *testing.B) {
+	values := batchValues(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Partition(values)
+	}
+}
+
+func BenchmarkParseLoop(b *testing.B) {
+	values := batchValues(100000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		vectors := make([]*CorrelationVector, len(values))
+		errs := make([]error, len(values))
+		for j, value := range values {
+			vectors[j], errs[j] = Parse(value)
+		}
+	}
+}
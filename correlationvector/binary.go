@@ -0,0 +1,143 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+const (
+	// binaryFlagImmutable marks an encoded correlation vector as terminated.
+	binaryFlagImmutable byte = 1 << iota
+
+	// binaryFlagRawBase marks an encoded base that is stored as its string bytes
+	// because it could not be packed as base64.
+	binaryFlagRawBase
+)
+
+var errInvalidBinary = errors.New("correlationvector: invalid binary encoding")
+
+// MarshalBinary implements encoding.BinaryMarshaler. The encoding holds the
+// version, a flags byte, the base packed back to its raw bytes (pre-base64),
+// and every extension segment as a uvarint, which is considerably smaller
+// than the text form for deep vectors.
+func (cv *CorrelationVector) MarshalBinary() ([]byte, error) {
+	parts := strings.Split(cv.baseVector, ".")
+	base := parts[0]
+
+	var flags byte
+	if cv.IsImmutable() {
+		flags |= binaryFlagImmutable
+	}
+	packed, ok := packBase(base)
+	if !ok {
+		flags |= binaryFlagRawBase
+		packed = []byte(base)
+	}
+
+	data := make([]byte, 0, 2+binary.MaxVarintLen64*(len(parts)+2)+len(packed))
+	data = append(data, byte(cv.version), flags)
+	data = binary.AppendUvarint(data, uint64(len(base)))
+	data = append(data, packed...)
+
+	data = binary.AppendUvarint(data, uint64(len(parts)))
+	for _, part := range parts[1:] {
+		segment, err := strconv.ParseUint(part, 10, 64)
+		if err != nil || strconv.FormatUint(segment, 10) != part {
+			return nil, errors.New("correlationvector: cannot encode extension segment " + part)
+		}
+		data = binary.AppendUvarint(data, segment)
+	}
+	return binary.AppendUvarint(data, uint64(cv.Extension())), nil
+}
+
+// UnmarshalBinaryCV creates a new correlation vector from the binary encoding
+// produced by MarshalBinary, reproducing the exact string value including the
+// terminator.
+func UnmarshalBinaryCV(data []byte) (*CorrelationVector, error) {
+	if len(data) < 2 {
+		return nil, errInvalidBinary
+	}
+	version, flags := Version(data[0]), data[1]
+	if version != V1Version && version != V2Version {
+		return nil, errors.New("correlationvector: invalid Version")
+	}
+	data = data[2:]
+
+	baseLength, n := binary.Uvarint(data)
+	if n <= 0 || baseLength > uint64(MaxVectorLengthV2) {
+		return nil, errInvalidBinary
+	}
+	data = data[n:]
+
+	var base string
+	if flags&binaryFlagRawBase != 0 {
+		if uint64(len(data)) < baseLength {
+			return nil, errInvalidBinary
+		}
+		base, data = string(data[:baseLength]), data[baseLength:]
+	} else {
+		packedLength := packedBaseLength(int(baseLength))
+		if len(data) < packedLength {
+			return nil, errInvalidBinary
+		}
+		base, data = unpackBase(data[:packedLength], int(baseLength)), data[packedLength:]
+	}
+
+	count, n := binary.Uvarint(data)
+	if n <= 0 || count == 0 || count > uint64(len(data)) {
+		return nil, errInvalidBinary
+	}
+	data = data[n:]
+
+	var baseVector strings.Builder
+	baseVector.WriteString(base)
+	for i := uint64(1); i < count; i++ {
+		segment, n := binary.Uvarint(data)
+		if n <= 0 {
+			return nil, errInvalidBinary
+		}
+		data = data[n:]
+		baseVector.WriteString(".")
+		baseVector.WriteString(strconv.FormatUint(segment, 10))
+	}
+
+	extension, n := binary.Uvarint(data)
+	if n <= 0 || n != len(data) || extension > math.MaxInt32 {
+		return nil, errInvalidBinary
+	}
+
+	cv := newCorrelationVector(baseVector.String(), int32(extension), version, flags&binaryFlagImmutable != 0)
+	cv.origin = OriginParsed
+	return cv, nil
+}
+
+// packedBaseLength Gets the number of bytes needed to hold the given number of base64 characters.
+func packedBaseLength(chars int) int {
+	return (chars*6 + 7) / 8
+}
+
+// packBase Decodes the base64 characters of the base back to the bytes they represent.
+func packBase(base string) ([]byte, bool) {
+	// Pad with zero-valued characters so any character count decodes losslessly.
+	padded := base + strings.Repeat("A", (4-len(base)%4)%4)
+	bytes, err := base64.StdEncoding.DecodeString(padded)
+	if err != nil {
+		return nil, false
+	}
+	return bytes[:packedBaseLength(len(base))], true
+}
+
+// unpackBase Encodes the packed bytes of a base back to the given number of base64 characters.
+func unpackBase(packed []byte, chars int) string {
+	padded := make([]byte, len(packed)+(3-len(packed)%3)%3)
+	copy(padded, packed)
+	return base64.StdEncoding.EncodeToString(padded)[:chars]
+}
@@ -0,0 +1,63 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"testing"
+)
+
+func TestBinaryRoundTrip(t *testing.T) {
+	v1 := NewCorrelationVector()
+	v2, _ := NewCorrelationVectorWithVersion(V2Version)
+	deep, _ := Parse("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.3")
+	terminated, _ := Parse("KZY+dsX2jEaZesgCPjJ2Ng.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.214.0!")
+	invalidBase, _ := Parse("tul4NUsfs9Cl7m-_.1.2")
+
+	for _, vector := range []*CorrelationVector{v1, v2, deep, terminated, invalidBase} {
+		data, err := vector.MarshalBinary()
+		if err != nil {
+			t.Errorf("Marshaling %s should not return error, got %v", vector.Value(), err)
+			continue
+		}
+
+		actual, err := UnmarshalBinaryCV(data)
+		if err != nil {
+			t.Errorf("Unmarshaling %s should not return error, got %v", vector.Value(), err)
+			continue
+		}
+		if actual.Value() != vector.Value() {
+			t.Errorf("Binary round trip should result in %s, got %s", vector.Value(), actual.Value())
+		}
+		if actual.Version() != vector.Version() {
+			t.Errorf("Binary round trip should result in version %d, got %d", vector.Version(), actual.Version())
+		}
+	}
+}
+
+func TestBinaryIsSmallerForDeepVectors(t *testing.T) {
+	vector, _ := Parse("KZY+dsX2jEaZesgCPjJ2Ng.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.214.0!")
+	data, _ := vector.MarshalBinary()
+	if len(data) >= len(vector.Value()) {
+		t.Errorf("Binary encoding should be smaller than %d bytes, got %d", len(vector.Value()), len(data))
+	}
+}
+
+func TestMarshalBinaryNonCanonicalSegment(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.01.2")
+	if _, err := vector.MarshalBinary(); err == nil {
+		t.Errorf("Marshaling non canonical extension segment should return error")
+	}
+}
+
+func TestUnmarshalBinaryTruncated(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.2")
+	data, _ := vector.MarshalBinary()
+
+	for i := 0; i < len(data); i++ {
+		if actual, err := UnmarshalBinaryCV(data[:i]); err == nil {
+			t.Errorf("Unmarshaling truncated data should return error, got %s", actual.Value())
+		}
+	}
+}
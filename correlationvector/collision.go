@@ -0,0 +1,80 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// collisionDetector remembers the most recently generated bases.
+type collisionDetector struct {
+	mutex       sync.Mutex
+	window      int
+	recent      *list.List
+	bases       map[string]*list.Element
+	collisions  uint64
+	onCollision func(base string, collisions uint64)
+}
+
+var detector atomic.Pointer[collisionDetector]
+
+// EnableCollisionDetection starts remembering the last window generated bases
+// and invokes onCollision, with the base and the number of collisions seen so
+// far, whenever a newly generated base is one of them. This is a diagnostic
+// for the randomness of base generation and is off by default, at no cost.
+// Memory is bounded by window bases, and only collisions between bases
+// generated by this process are caught. Enabling it again starts over.
+func EnableCollisionDetection(window int, onCollision func(base string, collisions uint64)) {
+	if window <= 0 {
+		DisableCollisionDetection()
+		return
+	}
+
+	detector.Store(&collisionDetector{
+		window:      window,
+		recent:      list.New(),
+		bases:       make(map[string]*list.Element, window),
+		onCollision: onCollision,
+	})
+}
+
+// DisableCollisionDetection stops detecting collisions of generated bases and
+// releases the bases remembered so far.
+func DisableCollisionDetection() {
+	detector.Store(nil)
+}
+
+// observeBase Records the given generated base when collision detection is enabled.
+func observeBase(base string) {
+	if d := detector.Load(); d != nil {
+		d.observe(base)
+	}
+}
+
+// observe Records the given generated base, reporting it when it is already known.
+func (d *collisionDetector) observe(base string) {
+	d.mutex.Lock()
+	if element, ok := d.bases[base]; ok {
+		d.recent.MoveToFront(element)
+		d.collisions++
+		collisions := d.collisions
+		d.mutex.Unlock()
+
+		if d.onCollision != nil {
+			d.onCollision(base, collisions)
+		}
+		return
+	}
+
+	d.bases[base] = d.recent.PushFront(base)
+	if d.recent.Len() > d.window {
+		oldest := d.recent.Back()
+		d.recent.Remove(oldest)
+		delete(d.bases, oldest.Value.(string))
+	}
+	d.mutex.Unlock()
+}
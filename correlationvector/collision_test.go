@@ -0,0 +1,44 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"testing"
+)
+
+func TestCollisionDetection(t *testing.T) {
+	bases := []string{"tul4NUsfs9Cl7mOf", "tul4NUsfs9Cl7mOg", "tul4NUsfs9Cl7mOf", "tul4NUsfs9Cl7mOh", "tul4NUsfs9Cl7mOi", "tul4NUsfs9Cl7mOg"}
+	next := 0
+	SetBaseGenerator(func(version Version) (string, error) {
+		next++
+		return bases[next-1], nil
+	})
+	defer ResetBaseGenerator()
+
+	var collided []string
+	var total uint64
+	EnableCollisionDetection(2, func(base string, collisions uint64) {
+		collided = append(collided, base)
+		total = collisions
+	})
+	defer DisableCollisionDetection()
+
+	for range bases {
+		NewCorrelationVector()
+	}
+
+	// With a window of 2, the second tul4NUsfs9Cl7mOg comes after it was evicted.
+	if len(collided) != 1 || collided[0] != "tul4NUsfs9Cl7mOf" || total != 1 {
+		t.Errorf("Collision detection should report tul4NUsfs9Cl7mOf once, got %v (%d)", collided, total)
+	}
+
+	DisableCollisionDetection()
+	next = 0
+	NewCorrelationVector()
+	NewCorrelationVector()
+	if len(collided) != 1 {
+		t.Errorf("Disabled collision detection should not report collisions, got %v", collided)
+	}
+}
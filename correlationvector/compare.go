@@ -0,0 +1,194 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+// Distance gets the number of increments separating two correlation vectors
+// of the same operation. When both share every segment but the last, it is
+// the absolute difference of their extensions, so "base.1.2" and "base.1.5"
+// are 3 apart. When one was extended from the value of the other, it is the
+// extension of the deeper one, so "base.1" and "base.1.5" are 5 apart. An
+// error is returned for any other pair.
+func Distance(a, b *CorrelationVector) (int64, error) {
+	if a == nil || b == nil {
+		return 0, errors.New("correlationvector: cannot compute distance of nil correlation vector")
+	}
+
+	partsA := strings.Split(a.baseVector, ".")
+	partsB := strings.Split(b.baseVector, ".")
+	if len(partsA) > len(partsB) {
+		a, b = b, a
+		partsA, partsB = partsB, partsA
+	}
+
+	switch {
+	case len(partsA) == len(partsB) && equalSegments(partsA, partsB):
+		distance := int64(a.Extension()) - int64(b.Extension())
+		if distance < 0 {
+			distance = -distance
+		}
+		return distance, nil
+	case len(partsA)+1 == len(partsB) && equalSegments(partsA, partsB[:len(partsA)]) &&
+		partsB[len(partsA)] == strconv.Itoa(int(a.Extension())):
+		return int64(b.Extension()), nil
+	}
+
+	return 0, errors.New("correlationvector: correlation vectors are not comparable")
+}
+
+// Compare orders two correlation vectors, returning -1 when a sorts before b,
+// 1 when a sorts after b and 0 when they are equal. They are ordered by base
+// first, lexically, then segment by segment numerically, so "base.2" sorts
+// before "base.10" unlike with a string comparison. A correlation vector sorts
+// before its descendants, such as "base.1" before "base.1.0", an unterminated
+// correlation vector sorts before the same terminated one, and nil sorts
+// before anything else.
+func Compare(a, b *CorrelationVector) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+
+	partsA := strings.Split(a.Unsealed(), ".")
+	partsB := strings.Split(b.Unsealed(), ".")
+	if c := strings.Compare(partsA[0], partsB[0]); c != 0 {
+		return c
+	}
+	for i := 1; i < len(partsA) && i < len(partsB); i++ {
+		if c := compareSegments(partsA[i], partsB[i]); c != 0 {
+			return c
+		}
+	}
+
+	switch {
+	case len(partsA) != len(partsB):
+		return compareInts(len(partsA), len(partsB))
+	case a.IsImmutable() == b.IsImmutable():
+		return 0
+	case b.IsImmutable():
+		return -1
+	}
+	return 1
+}
+
+// compareSegments Orders two extension segments numerically, falling back to a
+// lexical order for segments that are not numbers.
+func compareSegments(a, b string) int {
+	valueA, errA := strconv.ParseUint(a, 10, 64)
+	valueB, errB := strconv.ParseUint(b, 10, 64)
+	if errA != nil || errB != nil {
+		return strings.Compare(a, b)
+	}
+	switch {
+	case valueA < valueB:
+		return -1
+	case valueA > valueB:
+		return 1
+	}
+	return 0
+}
+
+// compareInts Orders two ints.
+func compareInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// HasSameBase checks whether both correlation vectors belong to the same root
+// operation by comparing only their base, ignoring extensions and terminator.
+// It returns false when either correlation vector is nil.
+func (cv *CorrelationVector) HasSameBase(other *CorrelationVector) bool {
+	if cv == nil || other == nil {
+		return false
+	}
+	return baseOf(cv.baseVector) == baseOf(other.baseVector)
+}
+
+// AreLinked checks whether both correlation vectors belong to the same
+// operation tree, either by sharing their base or through the links recorded
+// when roots were re-rooted by ReSpin or UpgradeVersion, including across
+// versions. The links are kept by the caller and looked up with the resolver,
+// which gets the base a base was re-rooted from, such as the base of the Parent
+// logged with the new root, or false when the base is not re-rooted; a nil
+// resolver only compares the bases. Every base is visited at most once, so a
+// resolver returning a cycle of links does not loop. It returns false when
+// either correlation vector is nil.
+func AreLinked(a, b *CorrelationVector, linkResolver func(base string) (parentBase string, ok bool)) bool {
+	if a == nil || b == nil {
+		return false
+	}
+
+	ancestors := linkedBases(baseOf(a.baseVector), linkResolver)
+	for base := range linkedBases(baseOf(b.baseVector), linkResolver) {
+		if ancestors[base] {
+			return true
+		}
+	}
+	return false
+}
+
+// linkedBases Gets the given base and every base it was re-rooted from
+// according to the resolver.
+func linkedBases(base string, linkResolver func(base string) (string, bool)) map[string]bool {
+	bases := map[string]bool{base: true}
+	for linkResolver != nil {
+		parent, ok := linkResolver(base)
+		if !ok || bases[parent] {
+			break
+		}
+		bases[parent] = true
+		base = parent
+	}
+	return bases
+}
+
+// VersionMatches checks whether both correlation vectors follow the same
+// protocol version. It returns false when either correlation vector is nil.
+func (cv *CorrelationVector) VersionMatches(other *CorrelationVector) bool {
+	if cv == nil || other == nil {
+		return false
+	}
+	return cv.version == other.version
+}
+
+// VersionMismatch checks whether the child correlation vector follows another
+// protocol version than the parent value it was propagated from, such as a V1
+// child under a V2 parent, to diagnose a service downgrading the protocol. An
+// error is returned when the version of the parent cannot be inferred or the
+// child is nil.
+func VersionMismatch(parent string, child *CorrelationVector) (bool, error) {
+	if child == nil {
+		return false, errors.New("correlationvector: cannot compare version of nil correlation vector")
+	}
+	version, err := inferVersion(trimBasePadding(parent))
+	if err != nil {
+		return false, err
+	}
+	return version != child.version, nil
+}
+
+// equalSegments Checks whether the given segments are the same.
+func equalSegments(a, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
@@ -0,0 +1,156 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int64
+	}{
+		{"tul4NUsfs9Cl7mOf.1.2", "tul4NUsfs9Cl7mOf.1.5", 3},
+		{"tul4NUsfs9Cl7mOf.1.5", "tul4NUsfs9Cl7mOf.1.2", 3},
+		{"tul4NUsfs9Cl7mOf.1", "tul4NUsfs9Cl7mOf.1.5", 5},
+		{"tul4NUsfs9Cl7mOf.1.5", "tul4NUsfs9Cl7mOf.1", 5},
+		{"tul4NUsfs9Cl7mOf.4!", "tul4NUsfs9Cl7mOf.1", 3},
+	}
+
+	for _, test := range tests {
+		a, _ := Parse(test.a)
+		b, _ := Parse(test.b)
+		actual, err := Distance(a, b)
+		if err != nil || actual != test.expected {
+			t.Errorf("Distance between %s and %s should be %d, got %d (%v)", test.a, test.b, test.expected, actual, err)
+		}
+	}
+}
+
+func TestDistanceNotComparable(t *testing.T) {
+	tests := []struct {
+		a, b string
+	}{
+		{"tul4NUsfs9Cl7mOf.1.2", "KZY+dsX2jEaZesgCPjJ2Ng.1.2"},
+		{"tul4NUsfs9Cl7mOf.1.2", "tul4NUsfs9Cl7mOf.2.2"},
+		{"tul4NUsfs9Cl7mOf.2", "tul4NUsfs9Cl7mOf.1.5"},
+		{"tul4NUsfs9Cl7mOf.1", "tul4NUsfs9Cl7mOf.1.5.1"},
+	}
+
+	for _, test := range tests {
+		a, _ := Parse(test.a)
+		b, _ := Parse(test.b)
+		if _, err := Distance(a, b); err == nil {
+			t.Errorf("Distance between %s and %s should return error", test.a, test.b)
+		}
+	}
+
+	if _, err := Distance(nil, NewCorrelationVector()); err == nil {
+		t.Errorf("Distance with nil correlation vector should return error")
+	}
+}
+
+func TestHasSameBase(t *testing.T) {
+	a, _ := Parse("tul4NUsfs9Cl7mOf.1.2")
+	b, _ := Parse("tul4NUsfs9Cl7mOf.3!")
+	c, _ := Parse("tul4NUsfs9Cl7mOg.1.2")
+
+	if !a.HasSameBase(b) {
+		t.Errorf("Vectors %s and %s should have the same base", a.Value(), b.Value())
+	}
+	if a.HasSameBase(c) {
+		t.Errorf("Vectors %s and %s should not have the same base", a.Value(), c.Value())
+	}
+
+	var nilVector *CorrelationVector
+	if a.HasSameBase(nil) || nilVector.HasSameBase(a) {
+		t.Errorf("Nil vector should not have the same base")
+	}
+}
+
+func TestAreLinked(t *testing.T) {
+	v1, _ := Parse("tul4NUsfs9Cl7mOf.1.2")
+	upgraded, _ := UpgradeVersion(v1.Value(), V2Version)
+	respun, _ := upgraded.ReSpin()
+	other, _ := Parse("KZY+dsX2jEaZesgCPjJ2Ng.1")
+
+	links := map[string]string{}
+	for _, root := range []*CorrelationVector{upgraded, respun} {
+		links[baseOf(root.Value())] = baseOf(root.Parent())
+	}
+	links[baseOf(other.Value())] = baseOf(other.Value())
+	resolver := func(base string) (string, bool) {
+		parent, ok := links[base]
+		return parent, ok
+	}
+
+	if !AreLinked(v1, respun, resolver) || !AreLinked(respun, upgraded, resolver) {
+		t.Errorf("Vectors re-rooted from %s should be linked to it", v1.Value())
+	}
+	if AreLinked(v1, respun, nil) || AreLinked(v1, other, resolver) || AreLinked(v1, nil, resolver) {
+		t.Errorf("Vectors without links should not be linked")
+	}
+	if !AreLinked(v1, v1, nil) {
+		t.Errorf("Vectors with the same base should be linked")
+	}
+}
+
+func TestVersionMatches(t *testing.T) {
+	v1, _ := Parse("tul4NUsfs9Cl7mOf.1")
+	v2, _ := Parse("KZY+dsX2jEaZesgCPjJ2Ng.1")
+	child, _ := Extend("tul4NUsfs9Cl7mOf.1")
+
+	if !v1.VersionMatches(child) || v1.VersionMatches(v2) || v1.VersionMatches(nil) {
+		t.Errorf("Vectors should match versions only when both are %s", V1Version)
+	}
+
+	if mismatch, err := VersionMismatch("KZY+dsX2jEaZesgCPjJ2Ng.1", child); err != nil || !mismatch {
+		t.Errorf("V1 child under V2 parent should be a version mismatch, got %v", err)
+	}
+	if mismatch, err := VersionMismatch("tul4NUsfs9Cl7mOf.1", child); err != nil || mismatch {
+		t.Errorf("V1 child under V1 parent should not be a version mismatch, got %v", err)
+	}
+	if _, err := VersionMismatch("tul4NUsfs9Cl7mO.1", child); err == nil {
+		t.Errorf("Version mismatch with invalid parent should return error")
+	}
+}
+
+func TestCompare(t *testing.T) {
+	values := []string{
+		"tul4NUsfs9Cl7mOf.10",
+		"tul4NUsfs9Cl7mOf.2!",
+		"tul4NUsfs9Cl7mOf.1.0",
+		"KZY+dsX2jEaZesgCPjJ2Ng.5",
+		"tul4NUsfs9Cl7mOf.2",
+		"tul4NUsfs9Cl7mOf.1",
+	}
+	vectors := make([]*CorrelationVector, 0, len(values)+1)
+	for _, value := range values {
+		vector, _ := Parse(value)
+		vectors = append(vectors, vector)
+	}
+	vectors = append(vectors, nil)
+
+	sort.Slice(vectors, func(i, j int) bool { return Compare(vectors[i], vectors[j]) < 0 })
+
+	var sorted []string
+	for _, vector := range vectors {
+		sorted = append(sorted, fmt.Sprint(vector))
+	}
+	expected := "<nil>,KZY+dsX2jEaZesgCPjJ2Ng.5,tul4NUsfs9Cl7mOf.1,tul4NUsfs9Cl7mOf.1.0,tul4NUsfs9Cl7mOf.2,tul4NUsfs9Cl7mOf.2!,tul4NUsfs9Cl7mOf.10"
+	if strings.Join(sorted, ",") != expected {
+		t.Errorf("Sorted correlation vectors should be %s, got %s", expected, strings.Join(sorted, ","))
+	}
+
+	a, _ := Parse("tul4NUsfs9Cl7mOf.1.2")
+	b, _ := Parse("tul4NUsfs9Cl7mOf.1.2")
+	if Compare(a, b) != 0 || Compare(nil, nil) != 0 {
+		t.Errorf("Equal correlation vectors should compare as 0")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// contextKey is the key under which the correlation vector is stored in a context.
+type contextKey struct{}
+
+// NewContext returns a copy of the parent context carrying the given correlation vector.
+func NewContext(ctx context.Context, cv *CorrelationVector) context.Context {
+	return context.WithValue(ctx, contextKey{}, cv)
+}
+
+// FromContext gets the correlation vector carried by the context, if any.
+func FromContext(ctx context.Context) (*CorrelationVector, bool) {
+	cv, ok := ctx.Value(contextKey{}).(*CorrelationVector)
+	return cv, ok && cv != nil
+}
+
+// IncrementContext increments the correlation vector carried by the context
+// and returns its new value, to be passed to an outbound call. It returns false
+// when the context has no correlation vector.
+func IncrementContext(ctx context.Context) (string, bool) {
+	cv, ok := FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	return cv.Increment(), true
+}
+
+// FromContextWithKey gets the correlation vector stored in the context under
+// the given key, to ease the migration from ad-hoc context conventions to
+// NewContext and FromContext. The value stored under the key may be either a
+// *CorrelationVector, which is returned as is, or a string, which is parsed
+// with Parse. It returns an error when there is no value under the key, when
+// the value has another type or when the string cannot be parsed.
+func FromContextWithKey(ctx context.Context, key interface{}) (*CorrelationVector, error) {
+	switch value := ctx.Value(key).(type) {
+	case *CorrelationVector:
+		if value == nil {
+			return nil, errors.New("correlationvector: no correlation vector in context")
+		}
+		return value, nil
+	case string:
+		return Parse(value)
+	case nil:
+		return nil, errors.New("correlationvector: no correlation vector in context")
+	default:
+		return nil, fmt.Errorf("correlationvector: unexpected correlation vector type %T in context", value)
+	}
+}
+
+// ForkContext returns a copy of the parent context carrying a child of its
+// correlation vector, created by extending the next increment of the parent, so
+// that every goroutine the work fans out to logs a distinct correlation vector
+// of the same operation tree. Concurrent forks are safe and always get distinct
+// children, but the increment a fork gets follows the order in which the forks
+// reach the parent, not the order in which their goroutines were started. The
+// parent context is returned unchanged when it has no correlation vector, when
+// its correlation vector cannot be incremented anymore, as TryIncrement
+// reports, or when no child can be created.
+func ForkContext(ctx context.Context) context.Context {
+	parent, ok := FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+
+	value, err := parent.TryIncrement()
+	if err != nil {
+		return ctx
+	}
+	child, _ := Extend(value)
+	if child == nil {
+		return ctx
+	}
+	return NewContext(ctx, child)
+}
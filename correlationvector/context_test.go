@@ -0,0 +1,93 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"context"
+	"strconv"
+	"testing"
+)
+
+func TestContextRoundTrip(t *testing.T) {
+	vector := NewCorrelationVector()
+	ctx := NewContext(context.Background(), vector)
+
+	actual, ok := FromContext(ctx)
+	if !ok || actual != vector {
+		t.Errorf("Correlation vector should be found in context")
+	}
+
+	if _, ok := FromContext(context.Background()); ok {
+		t.Errorf("Correlation vector should not be found in empty context")
+	}
+}
+
+func TestForkContext(t *testing.T) {
+	parent, _ := Extend("tul4NUsfs9Cl7mOf.1")
+	ctx := NewContext(context.Background(), parent)
+
+	all := make(chan string, 100)
+	for i := 0; i < 100; i++ {
+		go func() {
+			child, _ := FromContext(ForkContext(ctx))
+			all <- child.Value()
+		}()
+	}
+
+	unique := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		unique[<-all] = true
+	}
+	for i := 1; i <= 100; i++ {
+		expected := "tul4NUsfs9Cl7mOf.1." + strconv.Itoa(i) + ".0"
+		if !unique[expected] {
+			t.Errorf("Forked contexts should include the child %s", expected)
+		}
+	}
+
+	if ForkContext(context.Background()) != context.Background() {
+		t.Errorf("Forking a context without correlation vector should return it unchanged")
+	}
+
+	for _, value := range []string{"tul4NUsfs9Cl7mOf.1!", "tul4NUsfs9Cl7mOf.2147483647"} {
+		parent, _ = Parse(value)
+		ctx = NewContext(context.Background(), parent)
+		if ForkContext(ctx) != ctx || parent.Value() != value {
+			t.Errorf("Forking a context whose correlation vector %s cannot be incremented should return it unchanged, got %s", value, parent.Value())
+		}
+	}
+}
+
+func TestFromContextWithKey(t *testing.T) {
+	type legacyKey string
+	vector := NewCorrelationVector()
+	ctx := context.WithValue(context.Background(), legacyKey("typed"), vector)
+	ctx = context.WithValue(ctx, legacyKey("string"), "tul4NUsfs9Cl7mOf.1")
+	ctx = context.WithValue(ctx, legacyKey("other"), 1)
+
+	if actual, err := FromContextWithKey(ctx, legacyKey("typed")); err != nil || actual != vector {
+		t.Errorf("Correlation vector stored under a custom key should be found in context")
+	}
+	if actual, err := FromContextWithKey(ctx, legacyKey("string")); err != nil || actual.Value() != "tul4NUsfs9Cl7mOf.1" {
+		t.Errorf("Correlation vector string stored under a custom key should be parsed, got %v", err)
+	}
+	for _, key := range []legacyKey{"other", "missing"} {
+		if actual, err := FromContextWithKey(ctx, key); err == nil {
+			t.Errorf("Getting the correlation vector under key %s should return error, got %s", key, actual.Value())
+		}
+	}
+}
+
+func TestIncrementContext(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1")
+	ctx := NewContext(context.Background(), vector)
+
+	if value, ok := IncrementContext(ctx); !ok || value != "tul4NUsfs9Cl7mOf.2" || vector.Value() != value {
+		t.Errorf("Incrementing the correlation vector in context should return tul4NUsfs9Cl7mOf.2, got %s", value)
+	}
+	if value, ok := IncrementContext(context.Background()); ok || value != "" {
+		t.Errorf("Incrementing an empty context should return false, got %s", value)
+	}
+}
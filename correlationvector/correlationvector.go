@@ -5,13 +5,16 @@
 package correlationvector
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"hash/fnv"
 	"math"
 	"math/rand"
 	"strconv"
 	"strings"
+	"sync"
 	"sync/atomic"
 )
 
@@ -32,16 +35,104 @@ const (
 	CVTerminator string = "!"
 )
 
+// ErrInvalidExtension is returned when the extension of a correlation vector
+// is not a non-negative 32 bit integer.
+var ErrInvalidExtension = errors.New("correlationvector: invalid extension")
+
+// ParseError is returned when a segment of a correlation vector is invalid,
+// to locate the corruption in long values, and wraps the sentinel error
+// describing it, such as ErrInvalidExtension, for errors.Is. Parse only checks
+// the last extension, so only ParseStrict and validation locate an invalid
+// segment before it, such as the "xyz" of "base.1.xyz.2".
+type ParseError struct {
+	// Position is the index of the invalid segment, where the base is at 0,
+	// so the segment "xyz" of "base.1.xyz.2" is at 2.
+	Position int
+	// Segment is the invalid segment.
+	Segment string
+	// Err is the error describing why the segment is invalid.
+	Err error
+}
+
+// Error gets the message of the error.
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%v %s at position %d", e.Err, e.Segment, e.Position)
+}
+
+// Unwrap gets the error describing why the segment is invalid.
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+// ErrTooLong is returned instead of a terminated correlation vector when the
+// max length is reached while DisableTermination is set.
+var ErrTooLong = errors.New("correlationvector: correlation vector too long")
+
+// ErrMaxExtension is returned by TryIncrement and IncrementRange when the
+// extension of a correlation vector reaches the max 32 bit integer.
+var ErrMaxExtension = errors.New("correlationvector: max extension reached")
+
 // ValidateCorrelationVectorDuringCreation indicates whether or not to validate the
 // correlation vector on creation.
 var ValidateCorrelationVectorDuringCreation = false
 
+// ValidateStrict indicates whether or not validation, when enabled by
+// ValidateCorrelationVectorDuringCreation or done by ParseStrict, also checks
+// that the base decodes as base64, with either the standard or the URL
+// alphabet, to catch corrupted values which have the right base length.
+var ValidateStrict = false
+
+// DisableTermination indicates whether or not to return ErrTooLong from Extend
+// and Spin, instead of appending the terminator and freezing the correlation
+// vector, when its max length is reached. Increment cannot return an error, so
+// it leaves the correlation vector unchanged instead. Since nothing is then
+// terminated, OnTerminate is never invoked.
+var DisableTermination = false
+
+// RecognizedTerminators are the terminators that mark an inbound correlation
+// vector as terminated, for interop with services that seal vectors with
+// another marker than CVTerminator. A vector ending with any of them is parsed
+// as immutable and never extended again, but is always rendered with
+// CVTerminator. A terminator must not contain digits, base64 characters or
+// ".", and the list should not be changed while correlation vectors are being
+// parsed.
+var RecognizedTerminators = []string{CVTerminator}
+
+// OnTerminate is invoked, when set, every time a correlation vector is
+// terminated, such as when Extend, Spin or Increment reach its max length.
+var OnTerminate func(cv *CorrelationVector)
+
+// OnIncrement is invoked, when set, every time the extension of a correlation
+// vector is incremented by Increment, TryIncrement or IncrementRange, once per
+// increment.
+var OnIncrement func(cv *CorrelationVector)
+
 // CorrelationVector represents a lightweight vector for identifying and measuring causality.
 type CorrelationVector struct {
-	baseVector  string
-	extension   int32
-	version     Version
-	isImmutable bool
+	baseVector string
+	version    Version
+	parent     string
+	original   string
+	origin     Origin
+
+	// state holds the extension in its low 32 bits and immutableBit, so that
+	// increments and termination update both in a single atomic operation.
+	state atomic.Uint64
+
+	// maxLength is the max length overriding the one of the version, or 0.
+	maxLength int
+}
+
+// Vector is the subset of the methods of *CorrelationVector that code
+// propagating a correlation vector usually needs, so that such code can accept
+// a Vector and be tested with a fake. It reads the value to log, increments it
+// for outbound calls and checks the version and termination, but leaves out
+// the constructors and the rest of the methods to keep fakes small.
+type Vector interface {
+	Value() string
+	Increment() string
+	Version() Version
+	IsImmutable() bool
 }
 
 // Version represents a version of the correlation vector protocol.
@@ -55,6 +146,80 @@ const (
 	V2Version Version = 2
 )
 
+// String gets the name of the version of the correlation vector protocol.
+func (v Version) String() string {
+	switch v {
+	case V1Version:
+		return "V1"
+	case V2Version:
+		return "V2"
+	}
+	return "Unknown(" + strconv.Itoa(int(v)) + ")"
+}
+
+// BaseLength gets the base length of the version of the correlation vector
+// protocol, or 0 for an unknown version.
+func (v Version) BaseLength() int {
+	switch v {
+	case V1Version:
+		return BaseLength
+	case V2Version:
+		return BaseLengthV2
+	}
+	return 0
+}
+
+// MaxLength gets the max length of a correlation vector of the version of the
+// protocol, or 0 for an unknown version.
+func (v Version) MaxLength() int {
+	switch v {
+	case V1Version:
+		return MaxVectorLength
+	case V2Version:
+		return MaxVectorLengthV2
+	}
+	return 0
+}
+
+// Limits gets the base length, the max length and the max extension of the
+// given version of the correlation vector protocol, or zeros for an unknown
+// version.
+func Limits(v Version) (baseLen, maxLen int, maxExtension int64) {
+	if v.BaseLength() == 0 {
+		return 0, 0, 0
+	}
+	return v.BaseLength(), v.MaxLength(), math.MaxInt32
+}
+
+// Origin tells how a correlation vector was constructed.
+type Origin int
+
+const (
+	// OriginUnknown is the origin of a correlation vector that was not
+	// constructed by this package, such as a zero value.
+	OriginUnknown Origin = iota
+
+	// OriginGenerated is the origin of a new root correlation vector.
+	OriginGenerated
+
+	// OriginExtended is the origin of a correlation vector extended or spun
+	// from a received value.
+	OriginExtended
+
+	// OriginParsed is the origin of a correlation vector parsed from its value.
+	OriginParsed
+)
+
+var originNames = []string{"Unknown", "Generated", "Extended", "Parsed"}
+
+// String gets the name of the origin of a correlation vector.
+func (o Origin) String() string {
+	if o < 0 || int(o) >= len(originNames) {
+		return "Unknown(" + strconv.Itoa(int(o)) + ")"
+	}
+	return originNames[o]
+}
+
 // NewCorrelationVector initializes a new instance of the CorrelationVector struct.
 // This should only be called when no correlation vector was found in the message header.
 func NewCorrelationVector() *CorrelationVector {
@@ -62,93 +227,784 @@ func NewCorrelationVector() *CorrelationVector {
 	return cv
 }
 
+// Option configures the creation of a new correlation vector.
+type Option func(*options)
+
+type options struct {
+	baseLength   int
+	alphanumeric bool
+	maxLength    int
+	basePrefix   string
+}
+
+// WithBaseLength shortens the generated base of a V2 correlation vector to the
+// given length, clamped between 18 and 22 characters and rounded up from 21 to
+// 22, since a base64 string of 4k+1 characters cannot be decoded; zero or less
+// keeps the default. Every base character carries 6 random bits, so the chance
+// of a collision among k vectors with an n character base is about
+// k*k / 2^(6n+1): an 18 character base keeps it near 1 in 10^15 for a billion
+// vectors, against 1 in 10^22 for the full V2 base. Receivers infer the version from the base
+// length, so a V1 base cannot be shortened, which would make it ambiguous, and
+// the option is ignored for V1. This library parses, validates and extends
+// shortened V2 bases like full ones, but peers following the specification
+// may reject them.
+func WithBaseLength(n int) Option {
+	return func(o *options) {
+		o.baseLength = n
+	}
+}
+
+// WithAlphanumericBase restricts the generated base to the characters
+// [A-Za-z0-9], for systems with strict header value charsets or that match
+// correlation vectors with simple patterns. Bases with a "+" or "/" are
+// generated again, so the base keeps its length but every character carries
+// log2(62), about 5.95, random bits instead of 6, costing about 0.7 bit on a V1
+// base and 1 bit on a V2 base. Parsing still accepts the full base64 alphabet.
+func WithAlphanumericBase() Option {
+	return func(o *options) {
+		o.alphanumeric = true
+	}
+}
+
+// WithBasePrefix starts the generated base with the given prefix, such as a
+// short service or region tag to eyeball the provenance of a trace. The base
+// keeps its length, so the prefix takes the place of random characters and
+// every prefix character costs 6 random bits: a 4 character prefix leaves 72
+// random bits in a V1 base, which makes collisions likely after a few billion
+// vectors of the same prefix. The prefix must be made of base64 characters and
+// be shorter than the base, otherwise NewCorrelationVectorWithVersion returns
+// an error. Parsing and validation treat the prefixed base as any other base.
+func WithBasePrefix(prefix string) Option {
+	return func(o *options) {
+		o.basePrefix = prefix
+	}
+}
+
+// WithMaxLength overrides the max length of the version for the new
+// correlation vector, such as for services behind proxies allowing longer
+// header values; zero or less keeps the default. Increment, Spin and
+// IncrementRange terminate the correlation vector at the overridden length
+// instead. Correlation vectors longer than the max length of their version do
+// not interoperate with services following the specification, which terminate
+// or reject them, so the override is only meaningful between services that
+// agree on it. Correlation vectors created from its value with Extend get the
+// default max length again; use ExtendWithMaxLength instead.
+func WithMaxLength(n int) Option {
+	return func(o *options) {
+		o.maxLength = n
+	}
+}
+
 // NewCorrelationVectorWithVersion initializes a new instance of the
 // CorrelationVector struct of the given protocol version. This should
 // only be called when no correlation vector was found in the message header.
-func NewCorrelationVectorWithVersion(version Version) (*CorrelationVector, error) {
-	base, err := getUniqueValue(version)
+func NewCorrelationVectorWithVersion(version Version, opts ...Option) (*CorrelationVector, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	base, err := getUniqueValue(version, o)
 	if err != nil {
 		return nil, err
 	}
-	return newCorrelationVector(base, 0, version, false), nil
+	observeBase(base)
+	cv := newCorrelationVector(base, 0, version, false)
+	cv.origin = OriginGenerated
+	if o.maxLength > 0 {
+		cv.maxLength = o.maxLength
+	}
+	return cv, nil
 }
 
 // Extend creates a new correlation vector by extending an existing value.
-// this should be done at the entry point of an operation.
+// this should be done at the entry point of an operation. When the version
+// cannot be inferred from the length of the base, the value is extended as a
+// V1 correlation vector and the inference error is returned along with it.
 func Extend(correlationVector string) (*CorrelationVector, error) {
+	return ExtendWithSegment(correlationVector, 0)
+}
+
+// ExtendOrCreate creates a new correlation vector by extending an existing
+// value like Extend, or creates a new root of the given version when the value
+// is empty or invalid, such as when the inbound header is missing. It never
+// fails: an unknown version creates a V1 root instead, and a value which cannot
+// be extended while DisableTermination is set is replaced by a new root too.
+func ExtendOrCreate(correlationVector string, version Version) *CorrelationVector {
+	if cv, err := extendHeader(correlationVector); err == nil {
+		return cv
+	}
+
+	if version.BaseLength() == 0 {
+		version = V1Version
+	}
+	cv, _ := NewCorrelationVectorWithVersion(version)
+	return cv
+}
+
+// ExtendWithSegment creates a new correlation vector by extending an existing
+// value like Extend, but with the given child segment instead of 0, such as to
+// reconstruct a known tree or to give each shard of a fan-out a fixed child
+// index. The max length is enforced like Extend; a negative segment returns
+// ErrInvalidExtension.
+func ExtendWithSegment(correlationVector string, segment int32) (*CorrelationVector, error) {
+	if segment < 0 {
+		return nil, ErrInvalidExtension
+	}
+
+	cv, err := extend(correlationVector, segment, 0)
+	if cv != nil {
+		cv.original = correlationVector
+		cv.origin = OriginExtended
+	}
+	return cv, err
+}
+
+// ExtendWithMaxLength creates a new correlation vector by extending an
+// existing value like Extend, but with the given max length overriding the one
+// of its version, as set by WithMaxLength; zero or less keeps the default. The
+// same interoperability caveats apply.
+func ExtendWithMaxLength(correlationVector string, maxLength int) (*CorrelationVector, error) {
+	cv, err := extend(correlationVector, 0, maxLength)
+	if cv != nil {
+		cv.original = correlationVector
+		cv.origin = OriginExtended
+	}
+	return cv, err
+}
+
+// ExtendWithMaxDepth creates a new correlation vector by extending an existing
+// value like Extend, unless its depth would exceed maxDepth, in which case the
+// value is terminated instead. The depth is the number of extensions, so
+// extending "base.1.2" results in a depth of 3.
+func ExtendWithMaxDepth(correlationVector string, maxDepth int) (*CorrelationVector, error) {
+	if isImmutable(correlationVector) || depth(correlationVector) < maxDepth {
+		return Extend(correlationVector)
+	}
+
+	cv, err := terminate(trimBasePadding(correlationVector))
+	if cv != nil {
+		cv.original = correlationVector
+		cv.origin = OriginExtended
+	}
+	return cv, err
+}
+
+// ExtendStrict creates a new correlation vector by extending an existing value
+// like Extend, but fails instead of returning a terminated correlation vector,
+// to catch misconfigured or corrupt seed values during initialization. It
+// returns ErrTooLong when the value is already terminated or cannot be
+// extended without reaching its max length, and the validation error when the
+// value is invalid, regardless of ValidateCorrelationVectorDuringCreation.
+func ExtendStrict(correlationVector string) (*CorrelationVector, error) {
+	value := trimBasePadding(correlationVector)
+	if isImmutable(value) {
+		return nil, ErrTooLong
+	}
+	version, err := inferVersion(value)
+	if err != nil {
+		return nil, err
+	}
+	if err = validate(value, version); err != nil {
+		return nil, err
+	}
+	if isOversized(value, 0, version.MaxLength()) {
+		return nil, ErrTooLong
+	}
+	return Extend(correlationVector)
+}
+
+// extend Creates a new correlation vector by extending the given cv string with
+// the given segment and max length, where 0 means the max length of its version.
+func extend(correlationVector string, segment int32, maxLength int) (*CorrelationVector, error) {
+	correlationVector = trimBasePadding(correlationVector)
 	if isImmutable(correlationVector) {
 		return Parse(correlationVector)
 	}
 	version, err := inferVersion(correlationVector)
 
+	if maxLength <= 0 {
+		maxLength = 0
+	}
 	if ValidateCorrelationVectorDuringCreation {
-		if err = validate(correlationVector, version); err != nil {
+		if err = validateWithMaxLength(correlationVector, version, maxLength); err != nil {
 			return nil, err
 		}
 	}
+	if isOversized(correlationVector, segment, effectiveMaxLength(version, maxLength)) {
+		return terminate(correlationVector)
+	}
 
-	if isOversized(correlationVector, 0, version) {
-		return Parse(correlationVector + CVTerminator)
+	cv := &CorrelationVector{
+		baseVector: correlationVector,
+		version:    version,
+		maxLength:  maxLength,
 	}
-	return newCorrelationVector(correlationVector, 0, version, false), err
+	cv.state.Store(packState(segment, false))
+	return cv, err
 }
 
 // Parse creates a new correlation vector by parsing its string representation.
+// The terminator may only appear at the end of the value, where a redundant
+// second terminator, as left by two services terminating the same value, is
+// collapsed into one. It never panics, even on untrusted input such as a
+// header, and returns an error for a misplaced terminator or an invalid last
+// extension, located by a ParseError, but it only checks the last extension;
+// use ParseStrict to reject and locate any segment that is not well formed.
 func Parse(correlationVector string) (*CorrelationVector, error) {
+	correlationVector = trimBasePadding(correlationVector)
+	collapsed, ok := collapseTerminators(correlationVector)
+	if !ok {
+		return nil, fmt.Errorf("correlationvector: invalid correlation vector %s. too many terminators", correlationVector)
+	}
+	correlationVector = collapsed
 	version, err := inferVersion(correlationVector)
 	var isImmutable = isImmutable(correlationVector)
+	if hasMisplacedTerminator(correlationVector) {
+		return nil, fmt.Errorf("correlationvector: invalid correlation vector %s. misplaced terminator", correlationVector)
+	}
 
 	p := strings.LastIndex(correlationVector, ".")
 	if p > 0 {
-		var extensionVal string
-		if isImmutable {
-			extensionVal = correlationVector[p+1 : len(correlationVector)-1]
-		} else {
-			extensionVal = correlationVector[p+1:]
-		}
-		extension, exterr := strconv.Atoi(extensionVal)
+		extensionVal, _ := TrimTerminator(correlationVector[p+1:])
+		extension, exterr := strconv.ParseInt(extensionVal, 10, 32)
 		if exterr == nil && extension >= 0 {
-			return newCorrelationVector(correlationVector[:p], int32(extension), version, isImmutable), err
+			cv := newCorrelationVector(correlationVector[:p], int32(extension), version, isImmutable)
+			cv.origin = OriginParsed
+			return cv, err
 		}
-		return nil, errors.New("correlationvector: invalid extension")
+		return nil, &ParseError{Position: depth(correlationVector), Segment: extensionVal, Err: ErrInvalidExtension}
 	}
 
 	return nil, errors.New("correlationvector: invalid correlation vector string")
 }
 
+// ParseStrict creates a new correlation vector by parsing its string
+// representation like Parse, but rejects any value that is not well formed:
+// the base length must match a version, every extension segment must consist
+// of digits only, and the terminator may only appear once, at the very end.
+func ParseStrict(correlationVector string) (*CorrelationVector, error) {
+	correlationVector = trimBasePadding(correlationVector)
+	version, err := inferVersion(correlationVector)
+	if err != nil {
+		return nil, err
+	}
+
+	value, _ := TrimTerminator(correlationVector)
+	if hasMisplacedTerminator(correlationVector) {
+		return nil, fmt.Errorf("correlationvector: invalid correlation vector %s. misplaced terminator", correlationVector)
+	}
+	if err = validate(value, version); err != nil {
+		return nil, err
+	}
+	for i, part := range strings.Split(value, ".") {
+		if i > 0 && !isDigits(part) {
+			return nil, &ParseError{Position: i, Segment: part, Err: ErrInvalidExtension}
+		}
+	}
+
+	return Parse(correlationVector)
+}
+
+// FromParts creates a new correlation vector from its base and extension
+// stored separately, without formatting and parsing its value. The base must
+// have a base length of the given version and no extension of its own, and
+// the extension must be non-negative. Like Parse, a correlation vector over the
+// max length of its version is terminated.
+func FromParts(base string, extension int32, version Version) (*CorrelationVector, error) {
+	base = strings.TrimRight(base, "=")
+	if version.BaseLength() == 0 {
+		return nil, errors.New("correlationvector: invalid Version")
+	}
+	if !isBaseLength(len(base), version) || strings.Contains(base, ".") || containsTerminator(base) {
+		return nil, fmt.Errorf("correlationvector: invalid base value %s for a %s correlation vector", base, version)
+	}
+	if extension < 0 {
+		return nil, ErrInvalidExtension
+	}
+
+	cv := newCorrelationVector(base, extension, version, false)
+	cv.origin = OriginParsed
+	return cv, nil
+}
+
 // Increment increments the current extension by one. Do this before passing
-// the value to an outbound message header.
+// the value to an outbound message header. The returned string is exactly what
+// Value would return right after, including the terminator when the increment
+// terminates the correlation vector, so callers need not call Value again.
+// Increment is safe to call concurrently with Terminate: the extension and the
+// termination are updated in a single atomic operation, so an increment never
+// advances a terminated correlation vector and returns its terminated value
+// instead.
 func (cv *CorrelationVector) Increment() string {
-	if cv.isImmutable {
-		return cv.Value()
+	for {
+		state := cv.state.Load()
+		extension, immutable := unpackState(state)
+		if immutable || extension == math.MaxInt32 {
+			return formatValue(cv.baseVector, extension, immutable)
+		}
+		next := extension + 1
+
+		if isOversized(cv.baseVector, next, cv.maxVectorLength()) {
+			if DisableTermination {
+				return formatValue(cv.baseVector, extension, false)
+			}
+			if !cv.state.CompareAndSwap(state, state|immutableBit) {
+				continue
+			}
+			if OnTerminate != nil {
+				OnTerminate(cv)
+			}
+			return formatValue(cv.baseVector, extension, true)
+		}
+		if cv.state.CompareAndSwap(state, packState(next, false)) {
+			if OnIncrement != nil {
+				OnIncrement(cv)
+			}
+			return formatValue(cv.baseVector, next, false)
+		}
+	}
+}
+
+// TryIncrement increments the current extension by one like Increment, but
+// returns an error instead of the current value when the correlation vector
+// cannot be incremented anymore: ErrTooLong when it is terminated or the next
+// extension would exceed the max length, and ErrMaxExtension when the
+// extension is already the max 32 bit integer. The correlation vector is left
+// unchanged on error, and not terminated, so that the caller can react, such
+// as with ReSpin.
+func (cv *CorrelationVector) TryIncrement() (string, error) {
+	for {
+		state := cv.state.Load()
+		extension, immutable := unpackState(state)
+		if immutable {
+			return "", ErrTooLong
+		}
+		if extension == math.MaxInt32 {
+			return "", ErrMaxExtension
+		}
+
+		next := extension + 1
+		if isOversized(cv.baseVector, next, cv.maxVectorLength()) {
+			return "", ErrTooLong
+		}
+		if cv.state.CompareAndSwap(state, packState(next, false)) {
+			if OnIncrement != nil {
+				OnIncrement(cv)
+			}
+			return formatValue(cv.baseVector, next, false), nil
+		}
+	}
+}
+
+// Terminate explicitly terminates the correlation vector, even when it is
+// within its max length, such as in the last hop of an operation, and returns
+// its terminated value. Like a correlation vector terminated by reaching its
+// max length, it cannot be incremented, extended or spun anymore. OnTerminate
+// is invoked unless the correlation vector was already terminated. The
+// returned value is final: no concurrent Increment advances the extension past
+// it.
+func (cv *CorrelationVector) Terminate() string {
+	if cv.seal() && OnTerminate != nil {
+		OnTerminate(cv)
+	}
+	return cv.Value()
+}
+
+// WillTerminateOnIncrement checks whether the current value of the correlation
+// vector is the last one, so that it can be logged before the next Increment
+// terminates it. It is true when the next extension would exceed the max
+// length, or when the extension is already the max 32 bit integer and cannot
+// advance anymore. When DisableTermination is set, the next Increment leaves
+// the correlation vector unchanged instead of terminating it. It is false once
+// the correlation vector is terminated.
+func (cv *CorrelationVector) WillTerminateOnIncrement() bool {
+	extension, immutable := unpackState(cv.state.Load())
+	if immutable {
+		return false
 	}
+	return extension == math.MaxInt32 || isOversized(cv.baseVector, extension+1, cv.maxVectorLength())
+}
 
-	var snapshot int32
-	var next int32
+// IncrementRange increments the current extension by n in a single atomic step
+// and returns the n consecutive values, so that no other increment of the
+// correlation vector interleaves with them. When fewer than n increments fit,
+// the ones that fit are reserved and returned along with ErrTooLong; if the max
+// length was reached, the correlation vector is terminated like Increment does,
+// unless DisableTermination is set. When the max extension was reached
+// instead, the ones that fit are returned along with ErrMaxExtension, like
+// TryIncrement does. A terminated correlation vector returns no values and
+// ErrTooLong.
+func (cv *CorrelationVector) IncrementRange(n int) ([]string, error) {
+	if n <= 0 {
+		return nil, nil
+	}
+	maxExtension := maxFittingExtension(cv.baseVector, cv.maxVectorLength())
 	for {
-		snapshot = cv.extension
-		if snapshot == math.MaxInt32 {
-			return cv.Value()
+		state := cv.state.Load()
+		snapshot, immutable := unpackState(state)
+		if immutable {
+			return nil, ErrTooLong
+		}
+		count := int64(n)
+		if remaining := maxExtension - int64(snapshot); remaining < count {
+			count = remaining
+		}
+		if count < 0 {
+			count = 0
 		}
-		next = snapshot + 1
 
-		if isOversized(cv.baseVector, next, cv.version) {
-			cv.isImmutable = true
-			return cv.Value()
+		next := snapshot + int32(count)
+		terminated := int(count) < n && next < math.MaxInt32 && !DisableTermination
+		if !cv.state.CompareAndSwap(state, packState(next, terminated)) {
+			continue
 		}
-		if atomic.CompareAndSwapInt32(&cv.extension, snapshot, next) {
-			return cv.baseVector + "." + strconv.Itoa(int(next))
+
+		values := make([]string, count)
+		for i := range values {
+			values[i] = formatValue(cv.baseVector, snapshot+int32(i)+1, false)
+			if OnIncrement != nil {
+				OnIncrement(cv)
+			}
+		}
+		if int(count) == n {
+			return values, nil
+		}
+
+		if next == math.MaxInt32 {
+			return values, ErrMaxExtension
+		}
+		if terminated && OnTerminate != nil {
+			OnTerminate(cv)
 		}
+		return values, ErrTooLong
+	}
+}
+
+// Branch creates a new correlation vector by extending the current value of
+// this one, like Extend(cv.Value()) but without parsing it again, so that each
+// branch of a fan-out counts from its own 0 extension: branching "base.1" twice
+// results in two independent "base.1.0" correlation vectors. Unlike Increment,
+// it leaves this correlation vector unchanged, and unlike a copy, the branch at
+// one more depth starts a new extension. The branch keeps the max length of
+// this correlation vector and is terminated when this one is terminated or
+// when extending would exceed the max length, in which case Branch returns nil
+// instead when DisableTermination is set.
+func (cv *CorrelationVector) Branch() *CorrelationVector {
+	extension, immutable := unpackState(cv.state.Load())
+	value := formatValue(cv.baseVector, extension, immutable)
+	branch := &CorrelationVector{
+		baseVector: value,
+		version:    cv.version,
+		maxLength:  cv.maxLength,
+	}
+
+	switch {
+	case immutable:
+		branch.baseVector = cv.baseVector
+		branch.state.Store(packState(extension, true))
+	case isOversized(value, 0, cv.maxVectorLength()):
+		var err error
+		if branch, err = terminate(value); err != nil {
+			return nil
+		}
+		branch.maxLength = cv.maxLength
+	}
+	branch.original = value
+	branch.origin = OriginExtended
+	return branch
+}
+
+// ChildForLabel creates a child of the correlation vector for the named
+// sub-operation, such as "db" or "cache", so that the same label under the
+// same parent always results in the same child across retries. The child
+// segment is the FNV-1a 32 bit hash of the label, as UTF-8 bytes, kept to its
+// lower 16 bits, so "base.1" has the child "base.1.<segment>" where the
+// segment is between 0 and 65535. Distinct labels may share a segment, about
+// one chance in 65536 for a pair, so labels under the same parent should be
+// checked for collisions when they must be told apart. It does not increment
+// the correlation vector, and the child of a terminated correlation vector is
+// terminated too. ChildForLabel returns nil when the child would exceed the
+// max length while DisableTermination is set, or when the correlation vector
+// fails validation while ValidateCorrelationVectorDuringCreation is set.
+func (cv *CorrelationVector) ChildForLabel(label string) *CorrelationVector {
+	hash := fnv.New32a()
+	hash.Write([]byte(label))
+
+	value := cv.Value()
+	child, _ := extend(value, int32(hash.Sum32()&0xFFFF), cv.maxLength)
+	if child != nil {
+		child.original = value
+		child.origin = OriginExtended
+	}
+	return child
+}
+
+// ReSpin creates a new root correlation vector of the same version linked to
+// this one, so that correlation can continue once this vector is terminated or
+// close to its max length. This intentionally breaks the single-tree invariant
+// in exchange for continued correlation: the new root shares nothing with this
+// vector, and the link is only recorded by Parent on the new root. To
+// reconstruct the link downstream, log Parent alongside the value of the new
+// root where the re-root happens.
+func (cv *CorrelationVector) ReSpin() (*CorrelationVector, error) {
+	root, err := NewCorrelationVectorWithVersion(cv.version)
+	if err != nil {
+		return nil, err
 	}
+	root.parent = cv.Value()
+	return root, nil
+}
+
+// UpgradeVersion creates a new root correlation vector of the target version
+// linked to the given value, such as when a V1 service calls a V2 service and
+// correlation should continue with a V2 vector. This is a deliberate version
+// transition like ReSpin, not a reinterpretation of the value: the new root
+// has a fresh base and the link is only recorded by Parent on the new root,
+// which should be logged alongside its value to reconstruct the link. A value
+// which already has the target version is extended like Extend instead, and an
+// error is returned when the value is invalid or the target version unknown.
+func UpgradeVersion(correlationVector string, target Version) (*CorrelationVector, error) {
+	value := trimBasePadding(correlationVector)
+	version, err := inferVersion(value)
+	if err != nil {
+		return nil, err
+	}
+	unsealed, _ := TrimTerminator(value)
+	if err = validate(unsealed, version); err != nil {
+		return nil, err
+	}
+	if version == target {
+		return Extend(correlationVector)
+	}
+
+	root, err := NewCorrelationVectorWithVersion(target)
+	if err != nil {
+		return nil, err
+	}
+	root.parent = value
+	return root, nil
+}
+
+// WithBase creates a new correlation vector with the same extensions as this
+// one grafted onto the given base, which must have a base length of its
+// version. It is intended for test fixtures and replay tooling only, since it
+// breaks the link between the correlation vector and its operation. This
+// correlation vector is left unchanged, and the new one is terminated if it is
+// terminated or if the new base makes it exceed its max length.
+func (cv *CorrelationVector) WithBase(newBase string) (*CorrelationVector, error) {
+	newBase = strings.TrimRight(newBase, "=")
+	if !isBaseLength(len(newBase), cv.version) || strings.Contains(newBase, ".") || containsTerminator(newBase) {
+		return nil, fmt.Errorf("correlationvector: invalid base value %s for a %s correlation vector", newBase, cv.version)
+	}
+
+	baseVector := newBase + cv.baseVector[len(baseOf(cv.baseVector)):]
+	extension, immutable := unpackState(cv.state.Load())
+	grafted := &CorrelationVector{
+		baseVector: baseVector,
+		version:    cv.version,
+		origin:     cv.origin,
+		maxLength:  cv.maxLength,
+	}
+	grafted.state.Store(packState(extension, immutable || isOversized(baseVector, extension, cv.maxVectorLength())))
+	return grafted, nil
+}
+
+// DeriveReRootBase derives the base of a new root for this correlation vector
+// from the given salt, so that services sharing the salt independently compute
+// the same re-root base for the same parent and can reconstruct the link
+// without a shared registry. The base is made of the first 16 (V1) or 22 (V2)
+// characters of the standard base64 encoding, with padding, of the SHA-256
+// digest of the value of this correlation vector without its terminator, as
+// UTF-8 bytes, followed by the salt.
+func (cv *CorrelationVector) DeriveReRootBase(salt []byte) (string, error) {
+	baseLength := cv.version.BaseLength()
+	if baseLength == 0 {
+		return "", errors.New("correlationvector: invalid Version")
+	}
+
+	digest := sha256.New()
+	digest.Write([]byte(cv.Unsealed()))
+	digest.Write(salt)
+	return base64.StdEncoding.EncodeToString(digest.Sum(nil))[:baseLength], nil
+}
+
+// Parent gets the value of the correlation vector this one was re-rooted
+// from by ReSpin or UpgradeVersion, or an empty string when it was not
+// re-rooted.
+func (cv *CorrelationVector) Parent() string {
+	return cv.parent
+}
+
+// Original gets the value the correlation vector was created from by Extend,
+// as received, or an empty string when it was not created by Extend.
+func (cv *CorrelationVector) Original() string {
+	return cv.original
 }
 
 // Value gets the value of the correlation vector as a string.
 func (cv *CorrelationVector) Value() string {
-	var val = cv.baseVector + "." + strconv.Itoa(int(cv.extension))
-	if cv.isImmutable {
-		val += CVTerminator
+	extension, immutable := unpackState(cv.state.Load())
+	return formatValue(cv.baseVector, extension, immutable)
+}
+
+// Extension gets the current extension of the correlation vector, read
+// atomically so that it is consistent with concurrent increments.
+func (cv *CorrelationVector) Extension() int32 {
+	extension, _ := unpackState(cv.state.Load())
+	return extension
+}
+
+// ExtensionString gets the current extension of the correlation vector as the
+// last segment of its value, with the terminator if it is terminated, so
+// "tul4NUsfs9Cl7mOf.1.2!" has the extension string "2!".
+func (cv *CorrelationVector) ExtensionString() string {
+	extension, immutable := unpackState(cv.state.Load())
+	value := strconv.Itoa(int(extension))
+	if immutable {
+		value += CVTerminator
+	}
+	return value
+}
+
+// Len gets the length of the value of the correlation vector without building
+// the string.
+func (cv *CorrelationVector) Len() int {
+	extension, immutable := unpackState(cv.state.Load())
+	length := valueLength(cv.baseVector, extension)
+	if immutable {
+		length += len(CVTerminator)
+	}
+	return length
+}
+
+// Valid checks whether the correlation vector is well formed: its base length
+// matches its version, its extensions are non-negative and its value is within
+// the max length of its version, or the one overriding it. It returns false
+// for a nil or zero value.
+func (cv *CorrelationVector) Valid() bool {
+	if cv == nil {
+		return false
+	}
+
+	maxVectorLength := cv.maxVectorLength()
+	if cv.version.BaseLength() == 0 {
+		return false
+	}
+
+	extension := cv.Extension()
+	if extension < 0 || valueLength(cv.baseVector, extension) > maxVectorLength {
+		return false
+	}
+
+	parts := strings.Split(cv.baseVector, ".")
+	if !isBaseLength(len(parts[0]), cv.version) {
+		return false
+	}
+	for _, part := range parts[1:] {
+		if !isDigits(part) {
+			return false
+		}
+	}
+	return true
+}
+
+// Root gets the value of the root of the operation the correlation vector
+// belongs to, which is its base with a 0 extension, so "tul4NUsfs9Cl7mOf.3.1.4"
+// has the root "tul4NUsfs9Cl7mOf.0".
+func (cv *CorrelationVector) Root() string {
+	return baseOf(cv.baseVector) + ".0"
+}
+
+// BaseBytes gets the raw bytes behind the base of the correlation vector, by
+// decoding it as unpadded base64 with the standard alphabet or else the URL
+// alphabet, to correlate it with other byte-level identifiers. A V1 base
+// decodes to the 12 bytes it was generated from, but a V2 base is truncated
+// from 17 bytes to 22 characters, so only its first 16 bytes are recovered,
+// with the last 4 bits lost. An error is returned when the base does not
+// decode, such as one generated by a custom generator.
+func (cv *CorrelationVector) BaseBytes() ([]byte, error) {
+	return decodeBase(baseOf(cv.baseVector))
+}
+
+// Unsealed gets the value of the correlation vector without its terminator,
+// if any. It is intended for analysis only: the unsealed value must never be
+// propagated, since it would allow a terminated vector to be extended again.
+func (cv *CorrelationVector) Unsealed() string {
+	value, _ := TrimTerminator(cv.Value())
+	return value
+}
+
+// DisplayValue gets the value of the correlation vector without its
+// terminator, for presentation only. Propagation must always use Value or
+// Increment, which keep the terminator.
+func (cv *CorrelationVector) DisplayValue() string {
+	return cv.Unsealed()
+}
+
+// ShortID gets an 8 character identifier of the base of the correlation
+// vector, for presentation only, such as in dense views next to the full Value
+// shown on expansion. It is the first 8 characters of the unpadded URL base64
+// encoding of the FNV-64a hash of the base, so it is stable for a base but
+// carries only 48 bits: it is reasonably unique within a view but not globally
+// unique, and must never be used for correlation.
+func (cv *CorrelationVector) ShortID() string {
+	hash := fnv.New64a()
+	hash.Write([]byte(baseOf(cv.baseVector)))
+	return base64.RawURLEncoding.EncodeToString(hash.Sum(nil))[:8]
+}
+
+// Depth gets the number of extensions of the correlation vector, so
+// "tul4NUsfs9Cl7mOf.1.2" has a depth of 2.
+func (cv *CorrelationVector) Depth() int {
+	return depth(cv.baseVector) + 1
+}
+
+// Walk calls fn for every segment of the correlation vector in order, starting
+// with the base at index 0 and followed by each extension up to the current
+// one, and stops early when fn returns false. The segments are substrings of
+// the value, so no slice is allocated. The terminator is never part of a
+// segment; use IsImmutable to know whether the correlation vector is terminated.
+func (cv *CorrelationVector) Walk(fn func(segment string, index int) bool) {
+	rest := cv.baseVector
+	index := 0
+	for {
+		p := strings.IndexByte(rest, '.')
+		if p < 0 {
+			break
+		}
+		if !fn(rest[:p], index) {
+			return
+		}
+		rest = rest[p+1:]
+		index++
+	}
+	if !fn(rest, index) {
+		return
 	}
-	return val
+	fn(strconv.Itoa(int(cv.Extension())), index+1)
+}
+
+// IsRoot checks whether the correlation vector is a fresh root, which has a
+// single extension equal to 0, such as "tul4NUsfs9Cl7mOf.0". It is false once
+// the root is incremented, as for "tul4NUsfs9Cl7mOf.1", or extended, as for
+// "tul4NUsfs9Cl7mOf.0.0", and for a terminated correlation vector.
+func (cv *CorrelationVector) IsRoot() bool {
+	return !cv.IsImmutable() && !strings.Contains(cv.baseVector, ".") && cv.Extension() == 0
+}
+
+// IsImmutable checks whether the correlation vector is terminated, in which
+// case it cannot be incremented, extended or spun anymore.
+func (cv *CorrelationVector) IsImmutable() bool {
+	_, immutable := unpackState(cv.state.Load())
+	return immutable
+}
+
+// Origin gets how the correlation vector was constructed, such as whether it
+// was generated as a new root or extended from a received value. It is
+// metadata only and does not affect the value.
+func (cv *CorrelationVector) Origin() Origin {
+	return cv.origin
 }
 
 // Version gets the version of the correlation vector protocol.
@@ -156,36 +1012,196 @@ func (cv *CorrelationVector) Version() Version {
 	return cv.version
 }
 
+// maxVectorLength Gets the max length of the correlation vector, which is the
+// one of its version unless overridden.
+func (cv *CorrelationVector) maxVectorLength() int {
+	return effectiveMaxLength(cv.version, cv.maxLength)
+}
+
 // newCorrelationvector Creates a new CorrelationVector with the given parameters.
 func newCorrelationVector(baseVector string, extension int32, version Version, isImmutable bool) *CorrelationVector {
-	isImmutable = isImmutable || isOversized(baseVector, extension, version)
-	cv := CorrelationVector{baseVector, int32(extension), version, isImmutable}
-	return &cv
+	cv := &CorrelationVector{
+		baseVector: baseVector,
+		version:    version,
+	}
+	cv.state.Store(packState(extension, isImmutable || isOversized(baseVector, extension, version.MaxLength())))
+	return cv
 }
 
-// getUniqueValue Generates a unique Guid with the given CV version.
-func getUniqueValue(version Version) (string, error) {
-	switch version {
-	case V1Version:
-		bytes := make([]byte, 12)
+// immutableBit is the bit of the state of a correlation vector set once it is terminated.
+const immutableBit uint64 = 1 << 32
+
+// packState Packs the given extension and immutability into the state of a correlation vector.
+func packState(extension int32, immutable bool) uint64 {
+	state := uint64(uint32(extension))
+	if immutable {
+		state |= immutableBit
+	}
+	return state
+}
+
+// unpackState Gets the extension and immutability packed into the given state of a correlation vector.
+func unpackState(state uint64) (int32, bool) {
+	return int32(uint32(state)), state&immutableBit != 0
+}
+
+// seal Terminates the correlation vector, returning whether it was not terminated before.
+func (cv *CorrelationVector) seal() bool {
+	for {
+		state := cv.state.Load()
+		if state&immutableBit != 0 {
+			return false
+		}
+		if cv.state.CompareAndSwap(state, state|immutableBit) {
+			return true
+		}
+	}
+}
+
+// formatValue Formats the value of a correlation vector from the given base vector, extension and immutability.
+func formatValue(baseVector string, extension int32, immutable bool) string {
+	value := baseVector + "." + strconv.Itoa(int(extension))
+	if immutable {
+		value += CVTerminator
+	}
+	return value
+}
+
+var (
+	baseGeneratorMutex sync.RWMutex
+	baseGenerator      func(version Version) (string, error)
+)
+
+// SetBaseGenerator overrides the generation of the base of new correlation
+// vectors for the whole process, including any WithBaseLength option, so that
+// code creating correlation vectors can be made deterministic. It is intended
+// for tests only; call ResetBaseGenerator when the test is done.
+func SetBaseGenerator(fn func(version Version) (string, error)) {
+	baseGeneratorMutex.Lock()
+	defer baseGeneratorMutex.Unlock()
+	baseGenerator = fn
+}
+
+// ResetBaseGenerator restores the default random generation of the base of
+// new correlation vectors.
+func ResetBaseGenerator() {
+	SetBaseGenerator(nil)
+}
+
+// terminate Creates a new terminated correlation vector from the given cv string which
+// reached its max length, or returns ErrTooLong when termination is disabled.
+func terminate(correlationVector string) (*CorrelationVector, error) {
+	if DisableTermination {
+		return nil, ErrTooLong
+	}
+
+	cv, err := Parse(correlationVector + CVTerminator)
+	if cv != nil && OnTerminate != nil {
+		OnTerminate(cv)
+	}
+	return cv, err
+}
+
+// getUniqueValue Generates a unique Guid with the given CV version and options,
+// where a base length out of range means the full base length of the version.
+func getUniqueValue(version Version, o options) (string, error) {
+	baseGeneratorMutex.RLock()
+	generator := baseGenerator
+	baseGeneratorMutex.RUnlock()
+	if generator != nil {
+		return generator(version)
+	}
+
+	baseLength := version.BaseLength()
+	if baseLength == 0 {
+		return "", errors.New("correlationvector: invalid Version")
+	}
+	length := baseLength
+	if version == V2Version && o.baseLength > 0 {
+		length = clamp(o.baseLength, minBaseLengthV2, BaseLengthV2)
+		if length%4 == 1 {
+			length++
+		}
+	}
+	if len(o.basePrefix) >= length || strings.Trim(o.basePrefix, base64Alphabet) != "" {
+		return "", fmt.Errorf("correlationvector: invalid base prefix %s", o.basePrefix)
+	}
+	length -= len(o.basePrefix)
+
+	// The base takes 6 random bits per character from the base64 encoding of
+	// enough random bytes: 12 bytes encode exactly the 16 characters of a V1
+	// base, while 16 bytes would leave only 2 random bits in the last of the 22
+	// characters of a V2 base, so 17 bytes are encoded and truncated.
+	bytes := make([]byte, 12)
+	if version == V2Version {
+		bytes = make([]byte, 17)
+	}
+	for {
 		rand.Read(bytes)
-		return base64.StdEncoding.EncodeToString(bytes), nil
-	case V2Version:
+		base := base64.StdEncoding.EncodeToString(bytes)[:length]
+		if !o.alphanumeric || !strings.ContainsAny(base, "+/") {
+			return o.basePrefix + base, nil
+		}
+	}
+}
+
+// base64Alphabet is the alphabet of the standard base64 encoding the base is generated with.
+const base64Alphabet = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789+/"
+
+// entropySamples is the number of samples CheckEntropy takes from the random source.
+const entropySamples = 8
+
+// CheckEntropy checks that the random source used to generate the base of new
+// correlation vectors produces usable values, by reading a handful of samples
+// from it and verifying that none is all zeros and that no two are identical.
+// It is meant as a startup self-test to fail fast when the source is
+// misconfigured; a nil error does not prove the source is unpredictable. The
+// override set by SetBaseGenerator is not checked.
+func CheckEntropy() error {
+	seen := make(map[string]bool, entropySamples)
+	for i := 0; i < entropySamples; i++ {
 		bytes := make([]byte, 16)
-		rand.Read(bytes)
-		return base64.StdEncoding.EncodeToString(bytes)[:BaseLengthV2], nil
+		if _, err := rand.Read(bytes); err != nil {
+			return fmt.Errorf("correlationvector: reading the random source: %w", err)
+		}
+		if isZero(bytes) {
+			return errors.New("correlationvector: the random source returned zeros")
+		}
+		if seen[string(bytes)] {
+			return errors.New("correlationvector: the random source returned duplicate values")
+		}
+		seen[string(bytes)] = true
 	}
-	return "", errors.New("correlationvector: invalid Version")
+	return nil
+}
+
+// isZero Checks whether the given bytes are all zeros.
+func isZero(bytes []byte) bool {
+	for _, b := range bytes {
+		if b != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// InferVersion infers the version of the given correlation vector string from
+// the length of its base, without creating a correlation vector. When the base
+// length matches no version, it returns V1Version along with an error, which
+// means the version is ambiguous and was defaulted to V1, the way Extend and
+// Parse treat such a value.
+func InferVersion(correlationVector string) (Version, error) {
+	return inferVersion(trimBasePadding(correlationVector))
 }
 
 // inferVersion Infers the CV version for the given Cv string.
 func inferVersion(correlationVector string) (Version, error) {
 	index := strings.Index(correlationVector, ".")
 
-	switch index {
-	case BaseLength:
+	switch {
+	case index == BaseLength:
 		return V1Version, nil
-	case BaseLengthV2:
+	case isBaseLength(index, V2Version):
 		return V2Version, nil
 	}
 
@@ -195,39 +1211,99 @@ func inferVersion(correlationVector string) (Version, error) {
 
 // validate Checks if the given cv string is in validate format of the given CV version.
 func validate(correlationVector string, version Version) error {
-	var maxVectorLength int
-	var baseLength int
+	return validateWithMaxLength(correlationVector, version, 0)
+}
 
-	switch version {
-	case V1Version:
-		maxVectorLength = MaxVectorLength
-		baseLength = BaseLength
-	case V2Version:
-		maxVectorLength = MaxVectorLengthV2
-		baseLength = BaseLengthV2
-	default:
+// validateWithMaxLength Validates the given cv string like validate, against the
+// given max length, where 0 means the max length of its version.
+func validateWithMaxLength(correlationVector string, version Version, maxLength int) error {
+	maxVectorLength, baseLength := effectiveMaxLength(version, maxLength), version.BaseLength()
+	if baseLength == 0 {
 		return errors.New("correlationvector: invalid Version")
 	}
 
 	if correlationVector == "" || len(correlationVector) > maxVectorLength {
-		return fmt.Errorf("correlationvector: the V%d correlation vector cannot be empty or bigger than %d characters", int(version), maxVectorLength)
+		return fmt.Errorf("correlationvector: the %s correlation vector cannot be empty or bigger than %d characters", version, maxVectorLength)
+	}
+
+	if containsTerminator(correlationVector) {
+		return fmt.Errorf("correlationvector: invalid correlation vector %s. misplaced terminator", correlationVector)
 	}
 
 	parts := strings.Split(correlationVector, ".")
 
-	if len(parts) < 2 || len(parts[0]) != baseLength {
+	if len(parts) < 2 || !isBaseLength(len(parts[0]), version) || (ValidateStrict && !isBase64(parts[0])) {
 		return fmt.Errorf("correlationvector: invalid correlation vector %s. invalid base value %s", correlationVector, parts[0])
 	}
 
 	for i := 1; i < len(parts); i++ {
 		if result, err := strconv.Atoi(parts[i]); err != nil || result < 0 {
-			return fmt.Errorf("correlationvector: invalid correlation vector %s. invalid extension value %s", correlationVector, parts[i])
+			return &ParseError{Position: i, Segment: parts[i], Err: ErrInvalidExtension}
 		}
 	}
 
 	return nil
 }
 
+// minBaseLengthV2 is the min length of a V2 base shortened by WithBaseLength,
+// which keeps it longer than a V1 base so that the version can be inferred, and
+// decodable as base64 unlike a 17 character base.
+const minBaseLengthV2 = BaseLength + 2
+
+// isBaseLength Checks whether the given base length is one of the given
+// version: exactly 16 for V1, and 18, 19, 20 or 22 for V2, whose bases may be
+// shortened by WithBaseLength to any length that can be decoded as base64.
+func isBaseLength(length int, version Version) bool {
+	if version == V2Version {
+		return length >= minBaseLengthV2 && length <= BaseLengthV2 && length%4 != 1
+	}
+	return length == version.BaseLength() && length > 0
+}
+
+// clamp Gets the given value bounded by min and max.
+func clamp(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// isBase64 Checks whether the given base decodes as unpadded base64 with either
+// the standard or the URL alphabet.
+func isBase64(base string) bool {
+	_, err := decodeBase(base)
+	return err == nil
+}
+
+// decodeBase Decodes the given base as unpadded base64 with the standard
+// alphabet, falling back to the URL alphabet.
+func decodeBase(base string) ([]byte, error) {
+	bytes, err := base64.RawStdEncoding.DecodeString(base)
+	if err == nil {
+		return bytes, nil
+	}
+	if bytes, err := base64.RawURLEncoding.DecodeString(base); err == nil {
+		return bytes, nil
+	}
+	return nil, fmt.Errorf("correlationvector: invalid base value %s: %w", base, err)
+}
+
+// isDigits Checks whether the given string is made of decimal digits only.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
 // intLength Gets the length of the given non-negative integer.
 func intLength(num int32) int {
 	if num == 0 {
@@ -236,17 +1312,162 @@ func intLength(num int32) int {
 	return int(math.Log10(float64(num))) + 1
 }
 
+// baseOf Gets the base, which is the first component, of the given baseVector.
+func baseOf(baseVector string) string {
+	if p := strings.Index(baseVector, "."); p >= 0 {
+		return baseVector[:p]
+	}
+	return baseVector
+}
+
+// trimBasePadding Removes the base64 padding some implementations leave at the end
+// of the base of the given cv string, so that its length matches the version.
+func trimBasePadding(correlationVector string) string {
+	p := strings.Index(correlationVector, ".")
+	if p <= 0 || correlationVector[p-1] != '=' {
+		return correlationVector
+	}
+	return strings.TrimRight(correlationVector[:p], "=") + correlationVector[p:]
+}
+
+// depth Gets the number of extensions of the given cv string.
+func depth(correlationVector string) int {
+	return strings.Count(correlationVector, ".")
+}
+
+// valueLength Gets the length of the cv string with the given baseVector and extension.
+func valueLength(baseVector string, extension int32) int {
+	return len(baseVector) + 1 + intLength(extension)
+}
+
+// NeedsTermination checks whether the given cv string must be terminated before
+// being forwarded as is, such as by a proxy which does not increment it: it is
+// true when the value is not terminated and its length is at or over the max
+// length of its version, which is V1 when it cannot be inferred, like Extend.
+// Seal terminates it.
+func NeedsTermination(correlationVector string) bool {
+	correlationVector = trimBasePadding(correlationVector)
+	if correlationVector == "" || isImmutable(correlationVector) {
+		return false
+	}
+	version, _ := inferVersion(correlationVector)
+	return len(correlationVector) >= version.MaxLength()
+}
+
+// Seal gets the given cv string terminated, appending the terminator unless it
+// is already terminated, so that sealing a value twice is harmless.
+func Seal(value string) string {
+	if isImmutable(value) {
+		return value
+	}
+	return value + CVTerminator
+}
+
+// TrimTerminator gets the given cv string without its trailing terminator and
+// whether it had one. It is intended for analysis only: the trimmed value must
+// never be propagated, since it would allow a terminated vector to be extended
+// again.
+func TrimTerminator(value string) (string, bool) {
+	if terminator := terminatorOf(value); terminator != "" {
+		return strings.TrimSuffix(value, terminator), true
+	}
+	return value, false
+}
+
+// SplitBaseExtension splits the given cv string into its base and the dotted
+// chain of its extensions, so "tul4NUsfs9Cl7mOf.1.2!" splits into
+// "tul4NUsfs9Cl7mOf" and "1.2!". The terminator, if any, stays at the end of
+// the extension chain so that it is never lost by joining them back. A base
+// without any extension has an empty extension chain. It returns false when the
+// base or the extension chain is empty after a ".", or the terminator ends a
+// base without extensions.
+func SplitBaseExtension(value string) (base string, extension string, ok bool) {
+	p := strings.Index(value, ".")
+	if p < 0 {
+		return value, "", value != "" && !isImmutable(value)
+	}
+
+	base, extension = value[:p], value[p+1:]
+	unsealed, _ := TrimTerminator(extension)
+	return base, extension, base != "" && unsealed != ""
+}
+
 // isImmutable Checks whether the given cv string is immutable.
 func isImmutable(correlationVector string) bool {
-	return correlationVector != "" && strings.HasSuffix(correlationVector, CVTerminator)
+	return terminatorOf(correlationVector) != ""
 }
 
-// isOversized Checks whether the given cv, with its baseVector, extension and version is oversized.
-func isOversized(baseVector string, extension int32, version Version) bool {
+// terminatorOf Gets the recognized terminator the given cv string ends with,
+// or an empty string if it has none.
+func terminatorOf(correlationVector string) string {
+	for _, terminator := range RecognizedTerminators {
+		if terminator != "" && strings.HasSuffix(correlationVector, terminator) {
+			return terminator
+		}
+	}
+	return ""
+}
+
+// containsTerminator Checks whether the given cv string contains any recognized terminator.
+func containsTerminator(correlationVector string) bool {
+	for _, terminator := range RecognizedTerminators {
+		if terminator != "" && strings.Contains(correlationVector, terminator) {
+			return true
+		}
+	}
+	return false
+}
+
+// collapseTerminators Collapses a redundant second terminator at the end of the
+// given cv string into one, returning false when it ends with more than two.
+func collapseTerminators(correlationVector string) (string, bool) {
+	value, sealed := TrimTerminator(correlationVector)
+	if !sealed || !isImmutable(value) {
+		return correlationVector, true
+	}
+
+	unsealed, _ := TrimTerminator(value)
+	return value, !isImmutable(unsealed)
+}
+
+// hasMisplacedTerminator Checks whether the given cv string has a terminator
+// anywhere but as its single last character.
+func hasMisplacedTerminator(correlationVector string) bool {
+	value, _ := TrimTerminator(correlationVector)
+	return containsTerminator(value)
+}
+
+// maxFittingExtension Gets the largest extension the given baseVector can have
+// without exceeding the given max length.
+func maxFittingExtension(baseVector string, maxLength int) int64 {
+	maxExtension := int64(math.MaxInt32)
+	digits := maxLength - len(baseVector) - 1
+	if digits <= 0 {
+		return -1
+	}
+
+	fitting := int64(9)
+	for i := 1; i < digits && fitting < maxExtension; i++ {
+		fitting = fitting*10 + 9
+	}
+	if fitting > maxExtension {
+		return maxExtension
+	}
+	return fitting
+}
+
+// effectiveMaxLength Gets the given max length, or the one of the given version when it is 0.
+func effectiveMaxLength(version Version, maxLength int) int {
+	if maxLength > 0 {
+		return maxLength
+	}
+	return version.MaxLength()
+}
+
+// isOversized Checks whether the given cv, with its baseVector and extension, exceeds the given max length.
+func isOversized(baseVector string, extension int32, maxLength int) bool {
 	if baseVector == "" {
 		return false
 	}
-
-	var cvLen = len(baseVector) + 1 + intLength(extension)
-	return (version == V1Version && cvLen > MaxVectorLength) || (version == V2Version && cvLen > MaxVectorLengthV2)
+	return maxLength > 0 && valueLength(baseVector, extension) > maxLength
 }
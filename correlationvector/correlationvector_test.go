@@ -5,6 +5,11 @@
 package correlationvector
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strconv"
 	"strings"
 	"testing"
 )
@@ -30,6 +35,52 @@ func TestCorrelationVectorIncrementIsUniqueAcrossThreads(t *testing.T) {
 	}
 }
 
+func TestIncrementRacesWithTerminate(t *testing.T) {
+	for run := 0; run < 100; run++ {
+		vector, _ := Extend(NewCorrelationVector().Value())
+
+		var sealed string
+		all := make(chan string, 100)
+		done := make(chan bool)
+		for i := 0; i < 100; i++ {
+			go func(i int) {
+				if i == 50 {
+					sealed = vector.Terminate()
+					close(done)
+				}
+				all <- vector.Increment()
+			}(i)
+		}
+
+		results := make([]string, 0, 100)
+		for i := 0; i < 100; i++ {
+			results = append(results, <-all)
+		}
+		<-done
+
+		if vector.Value() != sealed || vector.Increment() != sealed {
+			t.Errorf("Terminated vector should keep the value %s returned by Terminate, got %s", sealed, vector.Value())
+			return
+		}
+		unique := make(map[string]bool)
+		for _, actual := range results {
+			if strings.HasSuffix(actual, CVTerminator) {
+				if actual != sealed {
+					t.Errorf("Increment racing with Terminate should return the sealed value %s, got %s", sealed, actual)
+				}
+				continue
+			}
+			if unique[actual] {
+				t.Errorf("Non unique CV found: %s", actual)
+			}
+			unique[actual] = true
+			if parsed, _ := Parse(actual); parsed.Extension() > vector.Extension() {
+				t.Errorf("Increment racing with Terminate should not advance past the sealed value %s, got %s", sealed, actual)
+			}
+		}
+	}
+}
+
 func TestCreateAndIncrementCorrelationVectorDefault(t *testing.T) {
 	vector := NewCorrelationVector()
 	splitVector := strings.Split(vector.Value(), ".")
@@ -111,6 +162,163 @@ func TestCreateAndIncrementCorrelationVectorV2(t *testing.T) {
 	}
 }
 
+func TestCreateCorrelationVectorWithBaseLength(t *testing.T) {
+	tests := []struct {
+		version  Version
+		length   int
+		expected int
+	}{
+		{V2Version, 18, 18},
+		{V2Version, 10, 18},
+		{V2Version, 17, 18},
+		{V2Version, 19, 19},
+		{V2Version, 20, 20},
+		{V2Version, 21, 22},
+		{V2Version, 40, 22},
+		{V2Version, 0, 22},
+		{V1Version, 10, 16},
+		{V1Version, 22, 16},
+	}
+
+	for _, test := range tests {
+		vector, err := NewCorrelationVectorWithVersion(test.version, WithBaseLength(test.length))
+		if err != nil {
+			t.Errorf("Creating vector with base length %d should not return error, got %v", test.length, err)
+			continue
+		}
+		splitVector := strings.Split(vector.Increment(), ".")
+		if len(splitVector[0]) != test.expected {
+			t.Errorf("New vector base should have length %d, got %d", test.expected, len(splitVector[0]))
+		}
+		if _, err := decodeBase(splitVector[0]); err != nil {
+			t.Errorf("New vector base should be valid base64, got %s", splitVector[0])
+		}
+		if vector.Version() != test.version {
+			t.Errorf("New vector should have version %d, got %d", test.version, vector.Version())
+		}
+		if splitVector[1] != "1" {
+			t.Errorf("Incremented vector extension should be 1, got %s", splitVector[1])
+		}
+	}
+}
+
+func TestShortenedBaseRoundTrip(t *testing.T) {
+	vector, _ := NewCorrelationVectorWithVersion(V2Version, WithBaseLength(18))
+	if !vector.Valid() {
+		t.Errorf("Vector with a shortened base should be valid, got %s", vector.Value())
+	}
+
+	extended, err := Extend(vector.Increment())
+	if err != nil || extended.Version() != V2Version || !extended.Valid() {
+		t.Errorf("Extending a shortened base should return a valid V2 vector, got %v", err)
+	}
+
+	header := http.Header{}
+	vector.SetHeader(header)
+	received, err := FromHeader(header)
+	if err != nil || received.Value() != header.Get(HeaderName)+".0" || !received.Valid() {
+		t.Errorf("Vector from header with a shortened base should extend it, got %v", err)
+	}
+}
+
+func TestSetBaseGenerator(t *testing.T) {
+	SetBaseGenerator(func(version Version) (string, error) {
+		if version == V2Version {
+			return "KZY+dsX2jEaZesgCPjJ2Ng", nil
+		}
+		return "tul4NUsfs9Cl7mOf", nil
+	})
+	defer ResetBaseGenerator()
+
+	if vector := NewCorrelationVector(); vector.Value() != "tul4NUsfs9Cl7mOf.0" {
+		t.Errorf("New vector should use the overridden base tul4NUsfs9Cl7mOf.0, got %s", vector.Value())
+	}
+	if vector, _ := NewCorrelationVectorWithVersion(V2Version); vector.Value() != "KZY+dsX2jEaZesgCPjJ2Ng.0" {
+		t.Errorf("New vector should use the overridden base KZY+dsX2jEaZesgCPjJ2Ng.0, got %s", vector.Value())
+	}
+
+	ResetBaseGenerator()
+	if vector := NewCorrelationVector(); vector.Value() == "tul4NUsfs9Cl7mOf.0" {
+		t.Errorf("New vector should use a random base after reset")
+	}
+}
+
+func TestVersionString(t *testing.T) {
+	tests := []struct {
+		version  Version
+		expected string
+	}{
+		{V1Version, "V1"},
+		{V2Version, "V2"},
+		{Version(3), "Unknown(3)"},
+	}
+
+	for _, test := range tests {
+		if test.version.String() != test.expected {
+			t.Errorf("Version %d should be named %s, got %s", int(test.version), test.expected, test.version.String())
+		}
+	}
+
+	ValidateCorrelationVectorDuringCreation = true
+	_, err := Extend("KZY+dsX2jEaZesgCPjJ2Ng.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647")
+	if err == nil || !strings.Contains(err.Error(), "the V2 correlation vector") {
+		t.Errorf("Validation error should name the version V2, got %v", err)
+	}
+	ValidateCorrelationVectorDuringCreation = false
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		version      Version
+		baseLen      int
+		maxLen       int
+		maxExtension int64
+	}{
+		{V1Version, 16, 63, 2147483647},
+		{V2Version, 22, 127, 2147483647},
+		{Version(3), 0, 0, 0},
+	}
+
+	for _, test := range tests {
+		baseLen, maxLen, maxExtension := Limits(test.version)
+		if baseLen != test.baseLen || maxLen != test.maxLen || maxExtension != test.maxExtension {
+			t.Errorf("Limits of %s should be %d, %d, %d, got %d, %d, %d", test.version, test.baseLen, test.maxLen, test.maxExtension, baseLen, maxLen, maxExtension)
+		}
+	}
+}
+
+func TestDeriveReRootBase(t *testing.T) {
+	v1, _ := Parse("tul4NUsfs9Cl7mOf.1.0!")
+	v2, _ := Parse("KZY+dsX2jEaZesgCPjJ2Ng.1.0")
+
+	tests := []struct {
+		vector   *CorrelationVector
+		salt     string
+		expected string
+	}{
+		{v1, "salt", base64.StdEncoding.EncodeToString(sha256Sum("tul4NUsfs9Cl7mOf.1.0salt"))[:16]},
+		{v2, "salt", base64.StdEncoding.EncodeToString(sha256Sum("KZY+dsX2jEaZesgCPjJ2Ng.1.0salt"))[:22]},
+	}
+
+	for _, test := range tests {
+		actual, err := test.vector.DeriveReRootBase([]byte(test.salt))
+		if err != nil || actual != test.expected {
+			t.Errorf("Re-root base of %s should be %s, got %s (%v)", test.vector.Value(), test.expected, actual, err)
+		}
+		if again, _ := test.vector.DeriveReRootBase([]byte(test.salt)); again != actual {
+			t.Errorf("Re-root base should be deterministic, got %s and %s", actual, again)
+		}
+		if other, _ := test.vector.DeriveReRootBase([]byte("other")); other == actual {
+			t.Errorf("Re-root base should depend on the salt")
+		}
+	}
+}
+
+func sha256Sum(s string) []byte {
+	sum := sha256.Sum256([]byte(s))
+	return sum[:]
+}
+
 func TestCreateCorrelationVectorFromString(t *testing.T) {
 	vector, _ := Extend("tul4NUsfs9Cl7mOf.1")
 	splitVector := strings.Split(vector.Value(), ".")
@@ -165,6 +373,89 @@ func TestCreateCorrelationVectorFromStringV2(t *testing.T) {
 	}
 }
 
+func TestExtendRecordsOriginal(t *testing.T) {
+	for _, cvStr := range []string{
+		"tul4NUsfs9Cl7mOf.1",
+		"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.0!",
+		"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23",
+	} {
+		vector, _ := Extend(cvStr)
+		if vector.Original() != cvStr {
+			t.Errorf("Extended vector original should be %s, got %s", cvStr, vector.Original())
+		}
+	}
+
+	if vector := NewCorrelationVector(); vector.Original() != "" {
+		t.Errorf("New vector should not have an original value, got %s", vector.Original())
+	}
+	if vector, _ := Parse("tul4NUsfs9Cl7mOf.1"); vector.Original() != "" {
+		t.Errorf("Parsed vector should not have an original value, got %s", vector.Original())
+	}
+}
+
+func TestExtendWithMaxDepth(t *testing.T) {
+	tests := []struct {
+		value    string
+		maxDepth int
+		expected string
+	}{
+		{"tul4NUsfs9Cl7mOf.1.2", 3, "tul4NUsfs9Cl7mOf.1.2.0"},
+		{"tul4NUsfs9Cl7mOf.1.2", 2, "tul4NUsfs9Cl7mOf.1.2!"},
+		{"tul4NUsfs9Cl7mOf.1.2!", 2, "tul4NUsfs9Cl7mOf.1.2!"},
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23", 10, "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23!"},
+	}
+
+	for _, test := range tests {
+		vector, _ := ExtendWithMaxDepth(test.value, test.maxDepth)
+		if vector.Value() != test.expected {
+			t.Errorf("Extending %s with max depth %d should result in %s, got %s", test.value, test.maxDepth, test.expected, vector.Value())
+		}
+		if vector.Original() != test.value {
+			t.Errorf("Extended vector original should be %s, got %s", test.value, vector.Original())
+		}
+	}
+}
+
+func TestExtendWithMaxDepthDisableTermination(t *testing.T) {
+	DisableTermination = true
+	defer func() { DisableTermination = false }()
+
+	if vector, err := ExtendWithMaxDepth("tul4NUsfs9Cl7mOf.1.2", 2); vector != nil || err != ErrTooLong {
+		t.Errorf("Extending cv over max depth should return ErrTooLong, got %v", err)
+	}
+}
+
+func TestPaddedBaseCorrelationVector(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected string
+		version  Version
+	}{
+		{"KZY+dsX2jEaZesgCPjJ2Ng==.1", "KZY+dsX2jEaZesgCPjJ2Ng.1", V2Version},
+		{"KZY+dsX2jEaZesgCPjJ2Ng==.1.0!", "KZY+dsX2jEaZesgCPjJ2Ng.1.0!", V2Version},
+		{"tul4NUsfs9Cl7mOf==.1", "tul4NUsfs9Cl7mOf.1", V1Version},
+	}
+
+	ValidateCorrelationVectorDuringCreation = true
+	defer func() { ValidateCorrelationVectorDuringCreation = false }()
+
+	for _, test := range tests {
+		vector, err := Parse(test.value)
+		if err != nil || vector.Value() != test.expected || vector.Version() != test.version {
+			t.Errorf("Parsing padded %s should result in %s %s, got %v", test.value, test.version, test.expected, err)
+		}
+		if vector, err = ParseStrict(test.value); err != nil || vector.Value() != test.expected {
+			t.Errorf("Strictly parsing padded %s should result in %s, got %v", test.value, test.expected, err)
+		}
+		if vector, err = Extend(test.value); err != nil || vector.Version() != test.version || !strings.HasPrefix(vector.Value(), strings.TrimSuffix(test.expected, CVTerminator)) {
+			t.Errorf("Extending padded %s should extend %s, got %v", test.value, test.expected, err)
+		}
+		if vector, err = Spin(test.value); err != nil || !strings.HasPrefix(vector.Value(), strings.TrimSuffix(test.expected, CVTerminator)) {
+			t.Errorf("Spinning padded %s should spin %s, got %v", test.value, test.expected, err)
+		}
+	}
+}
+
 func TestExtendEmptyCorrelationVector(t *testing.T) {
 	vector, err := Extend("")
 	if vector.Value() != ".0" {
@@ -225,6 +516,23 @@ func TestExtendTooManyCharsCorrelationVector(t *testing.T) {
 	ValidateCorrelationVectorDuringCreation = false
 }
 
+func TestExtendAmbiguousLengthCorrelationVector(t *testing.T) {
+	// The 23 characters base is neither a V1 nor a V2 base.
+	for _, cvStr := range []string{
+		"tul4NUsfs9Cl7mOfN/dupsl.1",
+		"tul4NUsfs9Cl7mOfN/dupsl.1!",
+		"tul4NUsfs9Cl7mOfN/dupsl.2147483647.2147483647.2147483647.2147483647.1",
+	} {
+		vector, err := Extend(cvStr)
+		if err == nil {
+			t.Errorf("Extending ambiguous length correlation vector %s should return error", cvStr)
+		}
+		if vector == nil || vector.Version() != V1Version {
+			t.Errorf("Extending ambiguous length correlation vector %s should fall back to V1", cvStr)
+		}
+	}
+}
+
 func TestExtendTooBigCorrelationVector(t *testing.T) {
 	ValidateCorrelationVectorDuringCreation = true
 	// Bigger than 63 chars
@@ -264,6 +572,152 @@ func TestExtendTooBigExtensionCorrelationVector(t *testing.T) {
 	ValidateCorrelationVectorDuringCreation = false
 }
 
+func TestParseStrict(t *testing.T) {
+	for _, cvStr := range []string{
+		"tul4NUsfs9Cl7mOf.1.2",
+		"tul4NUsfs9Cl7mOf.1.2!",
+		"KZY+dsX2jEaZesgCPjJ2Ng.1",
+	} {
+		vector, err := ParseStrict(cvStr)
+		if err != nil || vector.Value() != cvStr {
+			t.Errorf("Strictly parsing %s should succeed, got %v", cvStr, err)
+		}
+	}
+}
+
+func TestParseStrictRejectsMalformed(t *testing.T) {
+	for _, cvStr := range []string{
+		"tul4NUsfs9Cl7mOf.1.2!!",
+		"tul4NUsfs9Cl7mOf.1.2abc",
+		"tul4NUsfs9Cl7mOf.1a.2",
+		"tul4NUsfs9Cl7mOf.1!.2",
+		"tul4NUsfs9Cl7mOf!.1",
+		"tul4NUsfs9Cl7mOf.+1.2",
+		"tul4NUsfs9Cl7mOf.1..2",
+		"tul4NUsfs9Cl7mO.1",
+	} {
+		if vector, err := ParseStrict(cvStr); err == nil {
+			t.Errorf("Strictly parsing %s should return error, got %s", cvStr, vector.Value())
+		}
+	}
+}
+
+func TestParseRejectsMisplacedTerminator(t *testing.T) {
+	for _, cvStr := range []string{
+		"tul4NUsfs9Cl7mOf!.1",
+		"tul4NUsfs9Cl7mOf.1!.2",
+		"tul4NUsfs9Cl7mOf.1.2!!!",
+	} {
+		if vector, err := Parse(cvStr); err == nil {
+			t.Errorf("Parsing %s should return error, got %s", cvStr, vector.Value())
+		}
+	}
+
+	ValidateCorrelationVectorDuringCreation = true
+	defer func() { ValidateCorrelationVectorDuringCreation = false }()
+	if vector, err := Extend("tul4NUsfs9Cl7mOf.1!.2"); err == nil {
+		t.Errorf("Extending a vector with a misplaced terminator should return error, got %s", vector.Value())
+	}
+}
+
+func TestParseCollapsesRedundantTerminator(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected string
+	}{
+		{"tul4NUsfs9Cl7mOf.0!", "tul4NUsfs9Cl7mOf.0!"},
+		{"tul4NUsfs9Cl7mOf.0!!", "tul4NUsfs9Cl7mOf.0!"},
+		{"tul4NUsfs9Cl7mOf.0.!", ""},
+		{"tul4NUsfs9Cl7mOf.0!!!", ""},
+	} {
+		for _, fn := range []func(string) (*CorrelationVector, error){Parse, Extend} {
+			vector, err := fn(test.value)
+			if test.expected == "" {
+				if err == nil {
+					t.Errorf("Parsing or extending %s should return error, got %s", test.value, vector.Value())
+				}
+			} else if err != nil || vector.Value() != test.expected {
+				t.Errorf("Parsing or extending %s should return %s, got %v", test.value, test.expected, err)
+			}
+		}
+	}
+}
+
+func TestTooManyTerminatorsError(t *testing.T) {
+	var value = "tul4NUsfs9Cl7mOf.0!!!"
+	for _, fn := range []func(string) (*CorrelationVector, error){Parse, extendHeader} {
+		if _, err := fn(value); err == nil || !strings.Contains(err.Error(), value+". ") {
+			t.Errorf("Error for %s should show the value as received, got %v", value, err)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		parse    func(string) (*CorrelationVector, error)
+		position int
+		segment  string
+	}{
+		{"tul4NUsfs9Cl7mOf.1.xyz.2", ParseStrict, 2, "xyz"},
+		{"tul4NUsfs9Cl7mOf.1.2.xyz!", ParseStrict, 3, "xyz"},
+		{"tul4NUsfs9Cl7mOf.1.2.xyz!", Parse, 3, "xyz"},
+		{"tul4NUsfs9Cl7mOf.-1", Parse, 1, "-1"},
+		{"tul4NUsfs9Cl7mOf.1.-2.3", ParseStrict, 2, "-2"},
+	} {
+		_, err := test.parse(test.value)
+		var parseErr *ParseError
+		if !errors.As(err, &parseErr) || !errors.Is(err, ErrInvalidExtension) {
+			t.Errorf("Parsing %s should return a ParseError wrapping ErrInvalidExtension, got %v", test.value, err)
+			continue
+		}
+		if parseErr.Position != test.position || parseErr.Segment != test.segment {
+			t.Errorf("Parsing %s should report segment %s at position %d, got %s at %d", test.value, test.segment, test.position, parseErr.Segment, parseErr.Position)
+		}
+	}
+}
+
+func TestParseTooBigExtension(t *testing.T) {
+	for _, cvStr := range []string{
+		"tul4NUsfs9Cl7mOf.2147483648",
+		"tul4NUsfs9Cl7mOf.4294967296",
+		"tul4NUsfs9Cl7mOf.1.2147483648!",
+	} {
+		if vector, err := Parse(cvStr); !errors.Is(err, ErrInvalidExtension) {
+			t.Errorf("Parsing %s should return ErrInvalidExtension, got %v (%v)", cvStr, err, vector)
+		}
+	}
+
+	if vector, err := Parse("tul4NUsfs9Cl7mOf.2147483647"); err != nil || vector.Value() != "tul4NUsfs9Cl7mOf.2147483647" {
+		t.Errorf("Parsing max extension should succeed, got %v", err)
+	}
+}
+
+func TestValid(t *testing.T) {
+	v2, _ := NewCorrelationVectorWithVersion(V2Version)
+	terminated, _ := Parse("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.0!")
+	shortened, _ := NewCorrelationVectorWithVersion(V2Version, WithBaseLength(18))
+	for _, vector := range []*CorrelationVector{NewCorrelationVector(), v2, terminated, shortened} {
+		if !vector.Valid() {
+			t.Errorf("Vector %s should be valid", vector.Value())
+		}
+	}
+
+	insufficient, _ := Extend("tul4NUsfs9Cl7mO.1")
+	letters, _ := Parse("tul4NUsfs9Cl7mOf.x.1")
+	tooBig, _ := Parse("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.2147483647.2147483647")
+	for _, vector := range []*CorrelationVector{insufficient, letters, tooBig} {
+		if vector.Valid() {
+			t.Errorf("Vector %s should not be valid", vector.Value())
+		}
+	}
+
+	var nilVector *CorrelationVector
+	if nilVector.Valid() || (&CorrelationVector{}).Valid() {
+		t.Errorf("Nil and zero value vectors should not be valid")
+	}
+}
+
 func TestIncrementPastMaxWithTerminator(t *testing.T) {
 	vector, _ := Extend("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479")
 	vector.Increment()
@@ -281,6 +735,26 @@ func TestIncrementPastMaxWithTerminator(t *testing.T) {
 	}
 }
 
+func TestWillTerminateOnIncrement(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected bool
+	}{
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.8", false},
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.9", true},
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.9!", false},
+		{"KZY+dsX2jEaZesgCPjJ2Ng.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.214.8", false},
+		{"KZY+dsX2jEaZesgCPjJ2Ng.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.214.9", true},
+		{"tul4NUsfs9Cl7mOf.2147483646", false},
+		{"tul4NUsfs9Cl7mOf.2147483647", true},
+	} {
+		vector, _ := Parse(test.value)
+		if vector.WillTerminateOnIncrement() != test.expected {
+			t.Errorf("Whether incrementing %s terminates it should be %t", test.value, test.expected)
+		}
+	}
+}
+
 func TestIncrementPastMaxWithTerminatorV2(t *testing.T) {
 	vector, _ := Extend("KZY+dsX2jEaZesgCPjJ2Ng.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.214")
 	vector.Increment()
@@ -314,6 +788,156 @@ func TestExtendOverMaxCVLengthV2(t *testing.T) {
 	}
 }
 
+func TestExtendStrict(t *testing.T) {
+	terminated := false
+	OnTerminate = func(cv *CorrelationVector) { terminated = true }
+	defer func() { OnTerminate = nil }()
+
+	for _, value := range []string{
+		"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23",
+		"KZY+dsX2jEaZesgCPjJ2Ng.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2141",
+		"tul4NUsfs9Cl7mOf.1!",
+	} {
+		if vector, err := ExtendStrict(value); vector != nil || err != ErrTooLong {
+			t.Errorf("Strictly extending %s should return ErrTooLong, got %v", value, err)
+		}
+	}
+	if terminated {
+		t.Errorf("Strictly extending should not terminate a correlation vector")
+	}
+
+	if _, err := ExtendStrict("tul4NUsfs9Cl7mOf.x"); err == nil {
+		t.Errorf("Strictly extending an invalid cv should return error")
+	}
+
+	vector, err := ExtendStrict("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479")
+	if err != nil || vector.Value() != "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.0" {
+		t.Errorf("Strictly extending a cv which fits should extend it, got %v", err)
+	}
+}
+
+func TestNeedsTermination(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected bool
+	}{
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.234", true},
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.2345", true},
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23", false},
+		{"KZY+dsX2jEaZesgCPjJ2Ng.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.214.0", true},
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479", false},
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.234!", false},
+		{"tul4NUsfs9Cl7mOf.1", false},
+	} {
+		if NeedsTermination(test.value) != test.expected {
+			t.Errorf("Value %s should need termination: %t", test.value, test.expected)
+		}
+	}
+}
+
+func TestSeal(t *testing.T) {
+	var value = "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.234"
+	sealed := Seal(value)
+	if sealed != value+CVTerminator || Seal(sealed) != sealed {
+		t.Errorf("Sealing %s should append ! once, got %s and %s", value, sealed, Seal(sealed))
+	}
+	if NeedsTermination(sealed) {
+		t.Errorf("Sealed value %s should not need termination", sealed)
+	}
+}
+
+func TestDisableTermination(t *testing.T) {
+	DisableTermination = true
+	defer func() { DisableTermination = false }()
+
+	var baseVector = "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23"
+	if vector, err := Extend(baseVector); vector != nil || err != ErrTooLong {
+		t.Errorf("Extending cv with max length should return ErrTooLong, got %v", err)
+	}
+	if vector, err := Spin(baseVector); vector != nil || err != ErrTooLong {
+		t.Errorf("Spinning cv with max length should return ErrTooLong, got %v", err)
+	}
+
+	vector, _ := Extend("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479")
+	for i := 0; i < 20; i++ {
+		vector.Increment()
+	}
+	if vector.Value() != "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.9" {
+		t.Errorf("Incrementing past max correlation vector should leave it unterminated, got %s", vector.Value())
+	}
+}
+
+func TestOnTerminate(t *testing.T) {
+	var terminated []string
+	OnTerminate = func(cv *CorrelationVector) {
+		terminated = append(terminated, cv.Value())
+	}
+	defer func() { OnTerminate = nil }()
+
+	Extend("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23")
+	vector, _ := Extend("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479")
+	for i := 0; i < 20; i++ {
+		vector.Increment()
+	}
+	Parse("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.0!")
+
+	expected := []string{
+		"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23!",
+		"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.9!",
+	}
+	if strings.Join(terminated, " ") != strings.Join(expected, " ") {
+		t.Errorf("OnTerminate should be invoked for %v, got %v", expected, terminated)
+	}
+}
+
+func TestTrimTerminator(t *testing.T) {
+	tests := []struct {
+		value      string
+		expected   string
+		terminated bool
+	}{
+		{"tul4NUsfs9Cl7mOf.1.0!", "tul4NUsfs9Cl7mOf.1.0", true},
+		{"tul4NUsfs9Cl7mOf.1.0", "tul4NUsfs9Cl7mOf.1.0", false},
+		{"", "", false},
+	}
+
+	for _, test := range tests {
+		actual, terminated := TrimTerminator(test.value)
+		if actual != test.expected || terminated != test.terminated {
+			t.Errorf("Trimming %s should result in %s, %t, got %s, %t", test.value, test.expected, test.terminated, actual, terminated)
+		}
+	}
+
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.0!")
+	if vector.Unsealed() != "tul4NUsfs9Cl7mOf.1.0" {
+		t.Errorf("Unsealed value should be tul4NUsfs9Cl7mOf.1.0, got %s", vector.Unsealed())
+	}
+	if vector.Increment() != "tul4NUsfs9Cl7mOf.1.0!" {
+		t.Errorf("Unsealing should not change the terminated vector, got %s", vector.Value())
+	}
+}
+
+func TestRoot(t *testing.T) {
+	for _, cvStr := range []string{"tul4NUsfs9Cl7mOf.0", "tul4NUsfs9Cl7mOf.3", "tul4NUsfs9Cl7mOf.3.1.4", "tul4NUsfs9Cl7mOf.3.1.4!"} {
+		vector, _ := Parse(cvStr)
+		if vector.Root() != "tul4NUsfs9Cl7mOf.0" {
+			t.Errorf("Root of %s should be tul4NUsfs9Cl7mOf.0, got %s", cvStr, vector.Root())
+		}
+	}
+}
+
+func TestDisplayValue(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.0!")
+	if vector.DisplayValue() != "tul4NUsfs9Cl7mOf.1.0" || vector.Value() != "tul4NUsfs9Cl7mOf.1.0!" {
+		t.Errorf("Display value should drop the terminator only, got %s and %s", vector.DisplayValue(), vector.Value())
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.1.0")
+	if vector.DisplayValue() != vector.Value() {
+		t.Errorf("Display value of unterminated vector should be its value, got %s", vector.DisplayValue())
+	}
+}
+
 func TestImmutableCVWithTerminator(t *testing.T) {
 	var cvStr = "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.0!"
 
@@ -347,3 +971,750 @@ func TestImmutableCVWithTerminatorV2(t *testing.T) {
 		t.Errorf("Terminated CV should remain unchanged after spin operation")
 	}
 }
+
+func TestLenMatchesValue(t *testing.T) {
+	vector, _ := Extend("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479")
+	for i := 0; i < 12; i++ {
+		if vector.Len() != len(vector.Value()) {
+			t.Errorf("Len should be %d for %s, got %d", len(vector.Value()), vector.Value(), vector.Len())
+		}
+		vector.Increment()
+	}
+}
+
+func TestReSpinTerminatedCorrelationVector(t *testing.T) {
+	var cvStr = "KZY+dsX2jEaZesgCPjJ2Ng.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.2147483647.214.0!"
+
+	vector, _ := Parse(cvStr)
+	root, err := vector.ReSpin()
+	if err != nil {
+		t.Errorf("Re-spinning terminated vector should not return error, got %v", err)
+		return
+	}
+	if root.Parent() != cvStr {
+		t.Errorf("Re-spun vector parent should be %s, got %s", cvStr, root.Parent())
+	}
+	if root.Version() != V2Version {
+		t.Errorf("Re-spun vector should keep version %d, got %d", V2Version, root.Version())
+	}
+	if root.Increment() == cvStr {
+		t.Errorf("Re-spun vector should be incrementable")
+	}
+	if NewCorrelationVector().Parent() != "" {
+		t.Errorf("New vector should not have a parent")
+	}
+}
+
+func TestIncrementFormatsAcrossDigitBoundaries(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.0")
+	for i := 1; i <= 1000; i++ {
+		expected := "tul4NUsfs9Cl7mOf.1." + strconv.Itoa(i)
+		if actual := vector.Increment(); actual != expected || vector.Value() != expected {
+			t.Errorf("Incremented vector should be %s, got %s and %s", expected, actual, vector.Value())
+		}
+	}
+}
+
+func TestIncrementMatchesValue(t *testing.T) {
+	for _, cvStr := range []string{
+		"tul4NUsfs9Cl7mOf.1",
+		"tul4NUsfs9Cl7mOf.1!",
+		"tul4NUsfs9Cl7mOf.2147483647",
+		"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.8",
+		"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.9",
+	} {
+		vector, _ := Parse(cvStr)
+		for i := 0; i < 3; i++ {
+			if actual := vector.Increment(); actual != vector.Value() {
+				t.Errorf("Incrementing %s should return %s, got %s", cvStr, vector.Value(), actual)
+			}
+		}
+	}
+}
+
+func TestCheckEntropy(t *testing.T) {
+	if err := CheckEntropy(); err != nil {
+		t.Errorf("Checking the entropy of the default random source should not return error, got %v", err)
+	}
+	if !isZero(make([]byte, 16)) || isZero([]byte{0, 1}) {
+		t.Errorf("Only all zero bytes should be reported as zero")
+	}
+}
+
+func TestWalk(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.3.1.4!")
+	var segments []string
+	vector.Walk(func(segment string, index int) bool {
+		if index != len(segments) {
+			t.Errorf("Segment %s should have index %d, got %d", segment, len(segments), index)
+		}
+		segments = append(segments, segment)
+		return true
+	})
+	if strings.Join(segments, ",") != "tul4NUsfs9Cl7mOf,3,1,4" {
+		t.Errorf("Walking the vector should visit tul4NUsfs9Cl7mOf,3,1,4, got %s", strings.Join(segments, ","))
+	}
+
+	count := 0
+	vector.Walk(func(segment string, index int) bool {
+		count++
+		return index < 1
+	})
+	if count != 2 {
+		t.Errorf("Walking the vector should stop when the callback returns false, visited %d segments", count)
+	}
+}
+
+func TestOrigin(t *testing.T) {
+	extended, _ := Extend("tul4NUsfs9Cl7mOf.1")
+	parsed, _ := Parse("tul4NUsfs9Cl7mOf.1")
+	spun, _ := Spin("tul4NUsfs9Cl7mOf.1")
+	sealed, _ := Extend("tul4NUsfs9Cl7mOf.1!")
+	for _, test := range []struct {
+		vector   *CorrelationVector
+		expected Origin
+	}{
+		{NewCorrelationVector(), OriginGenerated},
+		{extended, OriginExtended},
+		{parsed, OriginParsed},
+		{spun, OriginExtended},
+		{sealed, OriginExtended},
+		{&CorrelationVector{}, OriginUnknown},
+	} {
+		if test.vector.Origin() != test.expected {
+			t.Errorf("Correlation vector %s should have origin %s, got %s", test.vector.Value(), test.expected, test.vector.Origin())
+		}
+	}
+
+	if Origin(7).String() != "Unknown(7)" {
+		t.Errorf("Unknown origin should be named Unknown(7), got %s", Origin(7))
+	}
+}
+
+func TestIncrementRange(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.7")
+	values, err := vector.IncrementRange(3)
+	if err != nil || strings.Join(values, ",") != "tul4NUsfs9Cl7mOf.1.8,tul4NUsfs9Cl7mOf.1.9,tul4NUsfs9Cl7mOf.1.10" {
+		t.Errorf("Incrementing a range should return 3 consecutive values, got %v and %v", values, err)
+	}
+	if vector.Value() != "tul4NUsfs9Cl7mOf.1.10" {
+		t.Errorf("Incrementing a range should advance the extension to 10, got %s", vector.Value())
+	}
+}
+
+func TestIncrementRangePastMax(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.7")
+	values, err := vector.IncrementRange(5)
+	if err != ErrTooLong || strings.Join(values, ",") != "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.8,tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.9" {
+		t.Errorf("Incrementing a range past max should return the values that fit and ErrTooLong, got %v and %v", values, err)
+	}
+	if vector.Value() != "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.9!" {
+		t.Errorf("Incrementing a range past max should terminate the vector, got %s", vector.Value())
+	}
+	if values, err = vector.IncrementRange(1); err != ErrTooLong || len(values) != 0 {
+		t.Errorf("Incrementing a range of a terminated vector should return ErrTooLong, got %v and %v", values, err)
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.2147483646")
+	if values, err = vector.IncrementRange(2); err != ErrMaxExtension || len(values) != 1 || vector.IsImmutable() {
+		t.Errorf("Incrementing a range past the max extension should return ErrMaxExtension, got %v and %v", values, err)
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.2147483645")
+	values, err = vector.IncrementRange(5)
+	if err != ErrMaxExtension || strings.Join(values, ",") != "tul4NUsfs9Cl7mOf.2147483646,tul4NUsfs9Cl7mOf.2147483647" || vector.IsImmutable() {
+		t.Errorf("Incrementing a range past the max extension should return the values that fit and ErrMaxExtension, got %v and %v", values, err)
+	}
+	if values, err = vector.IncrementRange(1); err != ErrMaxExtension || len(values) != 0 {
+		t.Errorf("Incrementing a range at the max extension should return ErrMaxExtension, got %v and %v", values, err)
+	}
+}
+
+func TestIncrementRangeConcurrent(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.0")
+	results := make(chan []string, 8)
+	for i := 0; i < 8; i++ {
+		go func() {
+			values, _ := vector.IncrementRange(10)
+			results <- values
+		}()
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 8; i++ {
+		values := <-results
+		first, _ := strconv.Atoi(strings.TrimPrefix(values[0], "tul4NUsfs9Cl7mOf."))
+		for j, value := range values {
+			if value != "tul4NUsfs9Cl7mOf."+strconv.Itoa(first+j) || seen[value] {
+				t.Errorf("Concurrent ranges should be contiguous and distinct, got %v", values)
+			}
+			seen[value] = true
+		}
+	}
+	if vector.Value() != "tul4NUsfs9Cl7mOf.80" {
+		t.Errorf("Concurrent ranges should advance the extension to 80, got %s", vector.Value())
+	}
+}
+
+func TestInferVersion(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected Version
+		valid    bool
+	}{
+		{"tul4NUsfs9Cl7mOf.1", V1Version, true},
+		{"KZY+dsX2jEaZesgCPjJ2Ng.1", V2Version, true},
+		{"tul4NUsfs9Cl7m.1", V1Version, false},
+		{"", V1Version, false},
+	} {
+		version, err := InferVersion(test.value)
+		if version != test.expected || (err == nil) != test.valid {
+			t.Errorf("Inferring the version of %s should return %s, got %s and %v", test.value, test.expected, version, err)
+		}
+	}
+}
+
+func TestRecognizedTerminators(t *testing.T) {
+	RecognizedTerminators = []string{CVTerminator, "#"}
+	defer func() { RecognizedTerminators = []string{CVTerminator} }()
+
+	vector, err := Extend("tul4NUsfs9Cl7mOf.1.2#")
+	if err != nil || !vector.IsImmutable() || vector.Value() != "tul4NUsfs9Cl7mOf.1.2!" {
+		t.Errorf("Extending a legacy sealed vector should return tul4NUsfs9Cl7mOf.1.2!, got %s and %v", vector.Value(), err)
+	}
+	if vector, err = Spin("tul4NUsfs9Cl7mOf.1.2#"); err != nil || vector.Value() != "tul4NUsfs9Cl7mOf.1.2!" {
+		t.Errorf("Spinning a legacy sealed vector should return tul4NUsfs9Cl7mOf.1.2!, got %s and %v", vector.Value(), err)
+	}
+	if vector, err = Parse("tul4NUsfs9Cl7mOf.1#.2"); err == nil {
+		t.Errorf("Parsing a vector with a misplaced legacy terminator should return error, got %s", vector.Value())
+	}
+}
+
+func TestExtendWithSegment(t *testing.T) {
+	vector, err := ExtendWithSegment("tul4NUsfs9Cl7mOf.1", 0)
+	if extended, _ := Extend("tul4NUsfs9Cl7mOf.1"); err != nil || vector.Value() != extended.Value() {
+		t.Errorf("Extending with segment 0 should behave like Extend, got %s", vector.Value())
+	}
+
+	if vector, err = ExtendWithSegment("tul4NUsfs9Cl7mOf.1", 2147483647); err != nil || vector.Value() != "tul4NUsfs9Cl7mOf.1.2147483647" {
+		t.Errorf("Extending with segment 2147483647 should return tul4NUsfs9Cl7mOf.1.2147483647, got %s", vector.Value())
+	}
+
+	var baseVector = "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.2147483647"
+	if vector, _ = ExtendWithSegment(baseVector, 100); vector.Value() != baseVector+CVTerminator {
+		t.Errorf("Extending past max with a segment should return %s!, got %s", baseVector, vector.Value())
+	}
+
+	if vector, err = ExtendWithSegment("tul4NUsfs9Cl7mOf.1", -1); err != ErrInvalidExtension {
+		t.Errorf("Extending with a negative segment should return ErrInvalidExtension, got %v", err)
+	}
+}
+
+func TestParseMalformedDoesNotPanic(t *testing.T) {
+	for _, cvStr := range []string{"", ".", "!", ".!", "..", "tul4NUsfs9Cl7mOf.", "tul4NUsfs9Cl7mOf.!", "tul4NUsfs9Cl7mOf.\u00e9", "\u00e9.\u00e9!", "=.1", "=="} {
+		if vector, err := Parse(cvStr); err == nil {
+			t.Errorf("Parsing %q should return error, got %s", cvStr, vector.Value())
+		}
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, cvStr := range []string{"tul4NUsfs9Cl7mOf.1", "KZY+dsX2jEaZesgCPjJ2Ng.1.2!", "tul4NUsfs9Cl7mOf.", ".!", "tul4NUsfs9Cl7mOf==.1"} {
+		f.Add(cvStr)
+	}
+	f.Fuzz(func(t *testing.T, cvStr string) {
+		vector, err := Parse(cvStr)
+		if err == nil && vector == nil {
+			t.Errorf("Parsing %q should return a correlation vector or an error", cvStr)
+		}
+		if err == nil {
+			if reparsed, err := Parse(vector.Value()); err != nil || reparsed.Value() != vector.Value() {
+				t.Errorf("Parsing the value %q of a parsed vector should return it unchanged, got %v", vector.Value(), err)
+			}
+		}
+	})
+}
+
+func TestVersionLengths(t *testing.T) {
+	for _, test := range []struct {
+		version    Version
+		baseLength int
+		maxLength  int
+	}{
+		{V1Version, 16, 63},
+		{V2Version, 22, 127},
+		{Version(3), 0, 0},
+	} {
+		if test.version.BaseLength() != test.baseLength || test.version.MaxLength() != test.maxLength {
+			t.Errorf("Version %s should have base length %d and max length %d, got %d and %d", test.version, test.baseLength, test.maxLength, test.version.BaseLength(), test.version.MaxLength())
+		}
+	}
+}
+
+func TestFromParts(t *testing.T) {
+	vector, err := FromParts("tul4NUsfs9Cl7mOf", 3, V1Version)
+	if err != nil || vector.Value() != "tul4NUsfs9Cl7mOf.3" || vector.Version() != V1Version {
+		t.Errorf("Creating a vector from parts should return tul4NUsfs9Cl7mOf.3, got %v", err)
+	}
+	if vector, err = FromParts("KZY+dsX2jEaZesgCPjJ2Ng==", 0, V2Version); err != nil || vector.Value() != "KZY+dsX2jEaZesgCPjJ2Ng.0" {
+		t.Errorf("Creating a vector from a padded base should return KZY+dsX2jEaZesgCPjJ2Ng.0, got %v", err)
+	}
+
+	for _, test := range []struct {
+		base      string
+		extension int32
+		version   Version
+	}{
+		{"tul4NUsfs9Cl7mOf", 0, V2Version},
+		{"tul4NUsfs9Cl7mOf", -1, V1Version},
+		{"tul4NUsfs9Cl7m.1", 0, V1Version},
+		{"tul4NUsfs9Cl7mOf", 0, Version(3)},
+	} {
+		if vector, err = FromParts(test.base, test.extension, test.version); err == nil {
+			t.Errorf("Creating a vector from %s, %d and %s should return error, got %s", test.base, test.extension, test.version, vector.Value())
+		}
+	}
+}
+
+func TestWithAlphanumericBase(t *testing.T) {
+	for _, version := range []Version{V1Version, V2Version} {
+		for i := 0; i < 100; i++ {
+			vector, err := NewCorrelationVectorWithVersion(version, WithAlphanumericBase())
+			base := baseOf(vector.baseVector)
+			if err != nil || len(base) != version.BaseLength() || strings.ContainsAny(base, "+/") {
+				t.Errorf("Generated %s base should be %d alphanumeric characters, got %s", version, version.BaseLength(), base)
+			}
+		}
+	}
+}
+
+func TestBranch(t *testing.T) {
+	vector, _ := Extend("tul4NUsfs9Cl7mOf.1")
+	vector.Increment()
+	a, b := vector.Branch(), vector.Branch()
+	a.Increment()
+
+	if a.Value() != "tul4NUsfs9Cl7mOf.1.1.1" || b.Value() != "tul4NUsfs9Cl7mOf.1.1.0" || vector.Value() != "tul4NUsfs9Cl7mOf.1.1" {
+		t.Errorf("Branches of tul4NUsfs9Cl7mOf.1.1 should count independently, got %s and %s", a.Value(), b.Value())
+	}
+	if expected, _ := Extend(vector.Value()); b.Value() != expected.Value() || b.Original() != expected.Original() || b.Origin() != expected.Origin() {
+		t.Errorf("Branch should be like extending the value %s, got %s", expected.Value(), b.Value())
+	}
+
+	for _, value := range []string{"tul4NUsfs9Cl7mOf.1!", "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23"} {
+		vector, _ := Parse(value)
+		expected, _ := Extend(vector.Value())
+		if branch := vector.Branch(); branch.Value() != expected.Value() || !branch.IsImmutable() {
+			t.Errorf("Branch of %s should be the terminated %s, got %s", value, expected.Value(), branch.Value())
+		}
+	}
+}
+
+func TestChildForLabel(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1")
+	db := vector.ChildForLabel("db")
+	if db.Value() != "tul4NUsfs9Cl7mOf.1.50883" || vector.ChildForLabel("db").Value() != db.Value() {
+		t.Errorf("Child for label db should be tul4NUsfs9Cl7mOf.1.50883, got %s", db.Value())
+	}
+	if cache := vector.ChildForLabel("cache"); cache.Value() == db.Value() {
+		t.Errorf("Children for labels db and cache should be distinct, got %s", cache.Value())
+	}
+	if vector.Value() != "tul4NUsfs9Cl7mOf.1" {
+		t.Errorf("Creating a child for a label should not increment the parent, got %s", vector.Value())
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.1!")
+	if child := vector.ChildForLabel("db"); child.Value() != "tul4NUsfs9Cl7mOf.1!" {
+		t.Errorf("Child for label of a terminated vector should be terminated, got %s", child.Value())
+	}
+}
+
+func TestSplitBaseExtension(t *testing.T) {
+	for _, test := range []struct {
+		value, base, extension string
+		ok                     bool
+	}{
+		{"tul4NUsfs9Cl7mOf", "tul4NUsfs9Cl7mOf", "", true},
+		{"tul4NUsfs9Cl7mOf.1", "tul4NUsfs9Cl7mOf", "1", true},
+		{"tul4NUsfs9Cl7mOf.1.2.3.4", "tul4NUsfs9Cl7mOf", "1.2.3.4", true},
+		{"tul4NUsfs9Cl7mOf.1.2!", "tul4NUsfs9Cl7mOf", "1.2!", true},
+		{"tul4NUsfs9Cl7mOf.", "tul4NUsfs9Cl7mOf", "", false},
+		{"tul4NUsfs9Cl7mOf.!", "tul4NUsfs9Cl7mOf", "!", false},
+		{".1", "", "1", false},
+		{"", "", "", false},
+	} {
+		base, extension, ok := SplitBaseExtension(test.value)
+		if base != test.base || extension != test.extension || ok != test.ok {
+			t.Errorf("Splitting %q should return %q, %q and %t, got %q, %q and %t", test.value, test.base, test.extension, test.ok, base, extension, ok)
+		}
+	}
+}
+
+func TestWithMaxLength(t *testing.T) {
+	vector, _ := NewCorrelationVectorWithVersion(V1Version, WithMaxLength(18))
+	for i := 0; i < 10; i++ {
+		vector.Increment()
+	}
+	if vector.Value() != baseOf(vector.baseVector)+".9!" {
+		t.Errorf("Incrementing past the overridden max length should terminate the vector, got %s", vector.Value())
+	}
+	if stats := vector.Stats(); stats.RemainingCapacity != 0 {
+		t.Errorf("Terminated vector should have no remaining capacity, got %d", stats.RemainingCapacity)
+	}
+}
+
+func TestExtendWithMaxLength(t *testing.T) {
+	var baseVector = "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23"
+	vector, err := ExtendWithMaxLength(baseVector, 255)
+	if err != nil || vector.Value() != baseVector+".0" || !vector.Valid() {
+		t.Errorf("Extending with a max length of 255 should return %s.0, got %s", baseVector, vector.Value())
+	}
+	if spin, _ := vector.Spin(nil); spin.IsImmutable() {
+		t.Errorf("Spinning a vector with a max length of 255 should not terminate it, got %s", spin.Value())
+	}
+	if stats := vector.Stats(); stats.RemainingCapacity != 255-len(baseVector)-2 {
+		t.Errorf("Remaining capacity should use the overridden max length, got %d", stats.RemainingCapacity)
+	}
+
+	if vector, _ = ExtendWithMaxLength(baseVector, 0); vector.Value() != baseVector+CVTerminator {
+		t.Errorf("Extending with the default max length should terminate the vector, got %s", vector.Value())
+	}
+}
+
+func TestExtendWithMaxLengthValidation(t *testing.T) {
+	ValidateCorrelationVectorDuringCreation = true
+	defer func() { ValidateCorrelationVectorDuringCreation = false }()
+
+	var baseVector = "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.2147483647.2147483647.21"
+	if vector, err := ExtendWithMaxLength(baseVector, 255); err != nil || vector.Value() != baseVector+".0" {
+		t.Errorf("Extending with validation and a max length of 255 should return %s.0, got %v", baseVector, err)
+	}
+	if _, err := ExtendWithMaxLength(baseVector, 0); err == nil {
+		t.Errorf("Extending with validation and the default max length should return error")
+	}
+}
+
+func TestChildForLabelDisableTermination(t *testing.T) {
+	DisableTermination = true
+	defer func() { DisableTermination = false }()
+
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23")
+	if child := vector.ChildForLabel("inventory"); child != nil {
+		t.Errorf("Child over max length with termination disabled should be nil, got %s", child.Value())
+	}
+}
+
+func TestChildForLabelKeepsMaxLength(t *testing.T) {
+	var baseVector = "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.2147483647.2147483647.21"
+	vector, _ := ExtendWithMaxLength(baseVector, 255)
+	child := vector.ChildForLabel("inventory")
+	if child.IsImmutable() || !strings.HasPrefix(child.Value(), baseVector+".0.") || child.Original() != vector.Value() {
+		t.Errorf("Child of a vector with a max length of 255 should not be terminated, got %s", child.Value())
+	}
+}
+
+func TestTerminate(t *testing.T) {
+	var terminated int
+	OnTerminate = func(cv *CorrelationVector) { terminated++ }
+	defer func() { OnTerminate = nil }()
+
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1")
+	if value := vector.Terminate(); value != "tul4NUsfs9Cl7mOf.1!" || !vector.IsImmutable() {
+		t.Errorf("Terminating a vector should return tul4NUsfs9Cl7mOf.1!, got %s", value)
+	}
+	if vector.Terminate(); terminated != 1 {
+		t.Errorf("OnTerminate should be invoked once, got %d", terminated)
+	}
+
+	if value := vector.Increment(); value != "tul4NUsfs9Cl7mOf.1!" {
+		t.Errorf("Incrementing a terminated vector should return tul4NUsfs9Cl7mOf.1!, got %s", value)
+	}
+	if extended, _ := Extend(vector.Value()); extended.Value() != "tul4NUsfs9Cl7mOf.1!" {
+		t.Errorf("Extending a terminated vector should return tul4NUsfs9Cl7mOf.1!, got %s", extended.Value())
+	}
+	if spin, _ := vector.Spin(nil); spin.Value() != "tul4NUsfs9Cl7mOf.1!" {
+		t.Errorf("Spinning a terminated vector should return tul4NUsfs9Cl7mOf.1!, got %s", spin.Value())
+	}
+}
+
+func TestValidateStrict(t *testing.T) {
+	ValidateCorrelationVectorDuringCreation = true
+	ValidateStrict = true
+	defer func() {
+		ValidateCorrelationVectorDuringCreation = false
+		ValidateStrict = false
+	}()
+
+	for _, cvStr := range []string{"tul4NUsfs9Cl7mOf.1", "tul4NU-_s9Cl7mOf.1", "KZY+dsX2jEaZesgCPjJ2Ng.1"} {
+		if _, err := Extend(cvStr); err != nil {
+			t.Errorf("Extending %s with strict validation should not return error, got %v", cvStr, err)
+		}
+	}
+	for _, cvStr := range []string{"tul4NU#fs9Cl7mOf.1", "tul4NU+_s9Cl7mOf.1", "KZY+dsX2jEaZ esgCPjJ2N.1"} {
+		if vector, err := Extend(cvStr); err == nil {
+			t.Errorf("Extending %s with strict validation should return error, got %s", cvStr, vector.Value())
+		}
+		if vector, err := ParseStrict(cvStr); err == nil {
+			t.Errorf("Strictly parsing %s with strict validation should return error, got %s", cvStr, vector.Value())
+		}
+	}
+
+	ValidateStrict = false
+	if _, err := Extend("tul4NU#fs9Cl7mOf.1"); err != nil {
+		t.Errorf("Extending a right length base which is not base64 should only fail with strict validation, got %v", err)
+	}
+}
+
+func TestOnIncrement(t *testing.T) {
+	var increments int
+	OnIncrement = func(cv *CorrelationVector) { increments++ }
+	defer func() { OnIncrement = nil }()
+
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1")
+	vector.Increment()
+	vector.IncrementRange(3)
+	vector.Terminate()
+	vector.Increment()
+	if increments != 4 {
+		t.Errorf("OnIncrement should be invoked once per increment, got %d", increments)
+	}
+}
+
+func TestWithBase(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.2")
+	grafted, err := vector.WithBase("A1b2C3d4E5f6G7h8")
+	if err != nil || grafted.Value() != "A1b2C3d4E5f6G7h8.1.2" || vector.Value() != "tul4NUsfs9Cl7mOf.1.2" {
+		t.Errorf("Grafting onto a new base should return A1b2C3d4E5f6G7h8.1.2 and leave the vector unchanged, got %s and %v", grafted.Value(), err)
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.1.2!")
+	if grafted, _ = vector.WithBase("A1b2C3d4E5f6G7h8"); grafted.Value() != "A1b2C3d4E5f6G7h8.1.2!" {
+		t.Errorf("Grafting a terminated vector should keep it terminated, got %s", grafted.Value())
+	}
+
+	vector = newCorrelationVector("A1b2C3d4.2147483647.2147483647.2147483647.2147483647", 100, V1Version, false)
+	if grafted, _ = vector.WithBase("A1b2C3d4E5f6G7h8"); vector.IsImmutable() || !grafted.IsImmutable() {
+		t.Errorf("Grafting a shortened base vector onto a full base past the max length should terminate it, got %s", grafted.Value())
+	}
+
+	vector, _ = Parse("KZY+dsX2jEaZesgCPjJ2Ng.1")
+	if grafted, err = vector.WithBase("A1b2C3d4E5f6G7h8I9"); err != nil || grafted.Value() != "A1b2C3d4E5f6G7h8I9.1" {
+		t.Errorf("Grafting onto a shortened V2 base should return A1b2C3d4E5f6G7h8I9.1, got %v", err)
+	}
+	if grafted, err = vector.WithBase("A1b2C3d4E5f6G7h8I"); err == nil {
+		t.Errorf("Grafting onto a 17 character V2 base should return error, got %s", grafted.Value())
+	}
+
+	vector = newCorrelationVector("A1b2C3d4.2147483647.2147483647.2147483647.2147483647", 100, V1Version, false)
+	for _, base := range []string{"A1b2C3d4E5f6G7h", "KZY+dsX2jEaZesgCPjJ2Ng", "A1b2C3d4E5f6G7.8"} {
+		if grafted, err = vector.WithBase(base); err == nil {
+			t.Errorf("Grafting onto base %s should return error, got %s", base, grafted.Value())
+		}
+	}
+}
+
+func TestExtensionString(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.2")
+	if vector.Extension() != 2 || vector.ExtensionString() != "2" {
+		t.Errorf("Extension of tul4NUsfs9Cl7mOf.1.2 should be 2, got %d and %s", vector.Extension(), vector.ExtensionString())
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.1.2!")
+	if vector.Extension() != 2 || vector.ExtensionString() != "2!" {
+		t.Errorf("Extension of tul4NUsfs9Cl7mOf.1.2! should be 2!, got %d and %s", vector.Extension(), vector.ExtensionString())
+	}
+}
+
+func TestV2BaseLastCharacterDistribution(t *testing.T) {
+	const samples = 64 * 200
+	counts := make(map[byte]int)
+	for i := 0; i < samples; i++ {
+		vector, _ := NewCorrelationVectorWithVersion(V2Version)
+		counts[vector.baseVector[BaseLengthV2-1]]++
+	}
+
+	// With 63 degrees of freedom, a chi-square above 120 has a probability of
+	// about 1 in 100000 for a uniform distribution.
+	var chiSquare float64
+	expected := float64(samples) / float64(len(base64Alphabet))
+	for i := 0; i < len(base64Alphabet); i++ {
+		deviation := float64(counts[base64Alphabet[i]]) - expected
+		chiSquare += deviation * deviation / expected
+	}
+	if chiSquare > 120 {
+		t.Errorf("Last character of V2 bases should be uniformly distributed, got a chi-square of %f", chiSquare)
+	}
+}
+
+func TestIsRoot(t *testing.T) {
+	if !NewCorrelationVector().IsRoot() {
+		t.Errorf("New correlation vector should be a root")
+	}
+	for _, test := range []struct {
+		value    string
+		expected bool
+	}{
+		{"tul4NUsfs9Cl7mOf.0", true},
+		{"tul4NUsfs9Cl7mOf.1", false},
+		{"tul4NUsfs9Cl7mOf.0.0", false},
+		{"tul4NUsfs9Cl7mOf.0!", false},
+	} {
+		if vector, _ := Parse(test.value); vector.IsRoot() != test.expected {
+			t.Errorf("Whether %s is a root should be %t", test.value, test.expected)
+		}
+	}
+}
+
+func TestTryIncrement(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.8")
+	if value, err := vector.TryIncrement(); err != nil || value != "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.9" {
+		t.Errorf("Trying to increment within max should succeed, got %s and %v", value, err)
+	}
+	if value, err := vector.TryIncrement(); err != ErrTooLong || value != "" {
+		t.Errorf("Trying to increment past max should return ErrTooLong, got %s and %v", value, err)
+	}
+	if vector.IsImmutable() || vector.Value() != "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.9" {
+		t.Errorf("Trying to increment past max should leave the vector unchanged, got %s", vector.Value())
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.2147483647")
+	if _, err := vector.TryIncrement(); err != ErrMaxExtension {
+		t.Errorf("Trying to increment past the max extension should return ErrMaxExtension, got %v", err)
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.1!")
+	if _, err := vector.TryIncrement(); err != ErrTooLong {
+		t.Errorf("Trying to increment a terminated vector should return ErrTooLong, got %v", err)
+	}
+}
+
+func TestBaseBytes(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1")
+	bytes, err := vector.BaseBytes()
+	if err != nil || base64.RawStdEncoding.EncodeToString(bytes) != "tul4NUsfs9Cl7mOf" {
+		t.Errorf("Base bytes of a V1 cv should encode back to its base, got %v", err)
+	}
+
+	vector, _ = Parse("KZY-dsX2jEaZesgCPjJ2Ng.1")
+	if bytes, err := vector.BaseBytes(); err != nil || len(bytes) != 16 {
+		t.Errorf("Base bytes of a V2 cv with the URL alphabet should be 16 bytes, got %d, %v", len(bytes), err)
+	}
+
+	vector = newCorrelationVector("tul4NUsfs9Cl7m:f", 1, V1Version, false)
+	if _, err := vector.BaseBytes(); err == nil {
+		t.Errorf("Base bytes of a cv with an invalid base should return error")
+	}
+}
+
+func TestExtendOrCreate(t *testing.T) {
+	if vector := ExtendOrCreate("tul4NUsfs9Cl7mOf.1", V2Version); vector.Value() != "tul4NUsfs9Cl7mOf.1.0" {
+		t.Errorf("Extending or creating from a valid cv should extend it, got %s", vector.Value())
+	}
+
+	for _, value := range []string{"", "tul4NUsfs9Cl7mO.1", "tul4NUsfs9Cl7mOf.x"} {
+		vector := ExtendOrCreate(value, V2Version)
+		if vector.Version() != V2Version || !vector.IsRoot() {
+			t.Errorf("Extending or creating from %q should create a V2 root, got %s", value, vector.Value())
+		}
+	}
+
+	if vector := ExtendOrCreate("", Version(42)); vector.Version() != V1Version {
+		t.Errorf("Extending or creating with an unknown version should create a V1 root, got %s", vector.Version())
+	}
+}
+
+func TestWithBasePrefix(t *testing.T) {
+	vector, err := NewCorrelationVectorWithVersion(V2Version, WithBasePrefix("weu1"))
+	if err != nil || !strings.HasPrefix(vector.Value(), "weu1") || len(baseOf(vector.Value())) != 22 {
+		t.Errorf("Vector with base prefix should have a 22 character base starting with weu1, got %v", err)
+		return
+	}
+	if _, err := ParseStrict(vector.Value()); err != nil {
+		t.Errorf("Vector with base prefix should be valid, got %v", err)
+	}
+
+	for _, prefix := range []string{"weu-", "tul4NUsfs9Cl7mOf"} {
+		if _, err := NewCorrelationVectorWithVersion(V1Version, WithBasePrefix(prefix)); err == nil {
+			t.Errorf("Vector with base prefix %s should return error", prefix)
+		}
+	}
+}
+
+func TestUpgradeVersion(t *testing.T) {
+	root, err := UpgradeVersion("tul4NUsfs9Cl7mOf.1.2", V2Version)
+	if err != nil || root.Version() != V2Version || !root.IsRoot() {
+		t.Errorf("Upgrading a V1 cv should create a V2 root, got %v", err)
+		return
+	}
+	if root.Parent() != "tul4NUsfs9Cl7mOf.1.2" {
+		t.Errorf("Upgraded vector parent should be tul4NUsfs9Cl7mOf.1.2, got %s", root.Parent())
+	}
+
+	if vector, err := UpgradeVersion("KZY+dsX2jEaZesgCPjJ2Ng.1", V2Version); err != nil || vector.Value() != "KZY+dsX2jEaZesgCPjJ2Ng.1.0" {
+		t.Errorf("Upgrading a cv of the target version should extend it, got %v", err)
+	}
+
+	if _, err := UpgradeVersion("tul4NUsfs9Cl7mOf.x", V2Version); err == nil {
+		t.Errorf("Upgrading an invalid cv should return error")
+	}
+	if _, err := UpgradeVersion("tul4NUsfs9Cl7mOf.1", Version(42)); err == nil {
+		t.Errorf("Upgrading to an unknown version should return error")
+	}
+}
+
+func TestShortID(t *testing.T) {
+	a, _ := Parse("tul4NUsfs9Cl7mOf.1.2")
+	b, _ := Parse("tul4NUsfs9Cl7mOf.3!")
+	c, _ := Parse("KZY+dsX2jEaZesgCPjJ2Ng.1")
+
+	if len(a.ShortID()) != 8 || a.ShortID() != b.ShortID() {
+		t.Errorf("Short ID should be the same 8 characters for the same base, got %s and %s", a.ShortID(), b.ShortID())
+	}
+	if a.ShortID() == c.ShortID() {
+		t.Errorf("Short ID should differ for different bases, got %s", a.ShortID())
+	}
+}
+
+func TestVectorInterface(t *testing.T) {
+	vector, _ := Extend("tul4NUsfs9Cl7mOf.1")
+	var v Vector = vector
+	if v.Increment() != "tul4NUsfs9Cl7mOf.1.1" || v.Value() != "tul4NUsfs9Cl7mOf.1.1" || v.Version() != V1Version || v.IsImmutable() {
+		t.Errorf("Vector interface should behave like the correlation vector, got %s", v.Value())
+	}
+}
+
+func BenchmarkValue(b *testing.B) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.7")
+	for i := 0; i < b.N; i++ {
+		vector.Value()
+	}
+}
+
+func BenchmarkIncrement(b *testing.B) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.0")
+	for i := 0; i < b.N; i++ {
+		if i%100 == 0 {
+			vector.state.Store(packState(0, false))
+		}
+		vector.Increment()
+	}
+}
+
+func TestDepthAndIsImmutable(t *testing.T) {
+	tests := []struct {
+		value     string
+		depth     int
+		immutable bool
+	}{
+		{"tul4NUsfs9Cl7mOf.0", 1, false},
+		{"tul4NUsfs9Cl7mOf.1.2", 2, false},
+		{"tul4NUsfs9Cl7mOf.1.2.3!", 3, true},
+	}
+
+	for _, test := range tests {
+		vector, _ := Parse(test.value)
+		if vector.Depth() != test.depth || vector.IsImmutable() != test.immutable {
+			t.Errorf("Vector %s should have depth %d and immutable %t, got %d and %t", test.value, test.depth, test.immutable, vector.Depth(), vector.IsImmutable())
+		}
+	}
+}
@@ -0,0 +1,39 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package echo contains an echo middleware propagating CorrelationVectors.
+package echo
+
+import (
+	"github.com/Microsoft/CorrelationVector-Go/correlationvector"
+	"github.com/labstack/echo/v4"
+)
+
+// ContextKey is the key under which Middleware stores the correlation vector
+// in the echo context.
+const ContextKey string = "correlationvector"
+
+// Middleware extends the correlation vector of the inbound request, or
+// generates a new one when it is missing or invalid, stores it in both the echo
+// context and the request context, and sets its value on the response header.
+func Middleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cv, err := correlationvector.FromHeader(c.Request().Header)
+			if err != nil {
+				cv = correlationvector.NewCorrelationVector()
+			}
+
+			c.Set(ContextKey, cv)
+			c.SetRequest(c.Request().WithContext(correlationvector.NewContext(c.Request().Context(), cv)))
+			c.Response().Header().Set(correlationvector.HeaderName, cv.Value())
+			return next(c)
+		}
+	}
+}
+
+// FromContext gets the correlation vector stored by Middleware in the echo context, if any.
+func FromContext(c echo.Context) (*correlationvector.CorrelationVector, bool) {
+	cv, ok := c.Get(ContextKey).(*correlationvector.CorrelationVector)
+	return cv, ok && cv != nil
+}
@@ -0,0 +1,48 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package echo contains an echo middleware propagating CorrelationVectors.
+package echo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Microsoft/CorrelationVector-Go/correlationvector"
+	"github.com/labstack/echo/v4"
+)
+
+func TestMiddleware(t *testing.T) {
+	e := echo.New()
+	e.Use(Middleware())
+
+	var fromEcho, fromRequest string
+	e.GET("/", func(c echo.Context) error {
+		if cv, ok := FromContext(c); ok {
+			fromEcho = cv.Value()
+		}
+		if cv, ok := correlationvector.FromContext(c.Request().Context()); ok {
+			fromRequest = cv.Value()
+		}
+		return c.NoContent(http.StatusOK)
+	})
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(correlationvector.HeaderName, "tul4NUsfs9Cl7mOf.1")
+	recorder := httptest.NewRecorder()
+	e.ServeHTTP(recorder, request)
+
+	if fromEcho != "tul4NUsfs9Cl7mOf.1.0" || fromRequest != "tul4NUsfs9Cl7mOf.1.0" {
+		t.Errorf("Middleware should store tul4NUsfs9Cl7mOf.1.0 in both contexts, got %s and %s", fromEcho, fromRequest)
+	}
+	if recorder.Header().Get(correlationvector.HeaderName) != "tul4NUsfs9Cl7mOf.1.0" {
+		t.Errorf("Middleware should set tul4NUsfs9Cl7mOf.1.0 on the response, got %s", recorder.Header().Get(correlationvector.HeaderName))
+	}
+
+	recorder = httptest.NewRecorder()
+	e.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusOK || recorder.Header().Get(correlationvector.HeaderName) == "" {
+		t.Errorf("Middleware should generate a correlation vector when the header is missing")
+	}
+}
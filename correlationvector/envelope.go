@@ -0,0 +1,39 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"time"
+)
+
+// Envelope is a ready-made record of a correlation vector and its metadata for
+// embedding in telemetry records.
+type Envelope struct {
+	Vector     *CorrelationVector `json:"-"`
+	Value      string             `json:"cv"`
+	Original   string             `json:"original,omitempty"`
+	ReceivedAt time.Time          `json:"receivedAt"`
+	Depth      int                `json:"depth"`
+	Immutable  bool               `json:"immutable"`
+}
+
+// NewEnvelope creates an envelope for the correlation vector extended from the
+// given inbound header value, received now. Like Extend, an envelope may be
+// returned along with an error for a value of unknown version.
+func NewEnvelope(header string) (*Envelope, error) {
+	cv, err := Extend(header)
+	if cv == nil {
+		return nil, err
+	}
+
+	return &Envelope{
+		Vector:     cv,
+		Value:      cv.Value(),
+		Original:   cv.Original(),
+		ReceivedAt: time.Now(),
+		Depth:      cv.Depth(),
+		Immutable:  cv.IsImmutable(),
+	}, err
+}
@@ -0,0 +1,36 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestNewEnvelope(t *testing.T) {
+	envelope, err := NewEnvelope("tul4NUsfs9Cl7mOf.1")
+	if err != nil {
+		t.Errorf("Creating envelope should not return error, got %v", err)
+		return
+	}
+	if envelope.Value != "tul4NUsfs9Cl7mOf.1.0" || envelope.Original != "tul4NUsfs9Cl7mOf.1" || envelope.Depth != 2 || envelope.Immutable {
+		t.Errorf("Envelope should describe tul4NUsfs9Cl7mOf.1.0, got %+v", envelope)
+	}
+	if envelope.ReceivedAt.IsZero() {
+		t.Errorf("Envelope should record when it was received")
+	}
+
+	data, _ := json.Marshal(envelope)
+	if !strings.Contains(string(data), `"cv":"tul4NUsfs9Cl7mOf.1.0","original":"tul4NUsfs9Cl7mOf.1","receivedAt":`) ||
+		!strings.HasSuffix(string(data), `"depth":2,"immutable":false}`) {
+		t.Errorf("Envelope JSON should carry the correlation vector metadata, got %s", data)
+	}
+
+	envelope, _ = NewEnvelope("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.0!")
+	if !envelope.Immutable || envelope.Depth != 5 {
+		t.Errorf("Envelope should describe a terminated vector of depth 5, got %+v", envelope)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"fmt"
+)
+
+// Format implements fmt.Formatter. The %v and %s verbs print the value of the
+// correlation vector and %q prints it quoted, with width, precision and flags
+// applied to the value string. The %+v verb prints the base, extension and
+// version of the correlation vector for debugging.
+func (cv *CorrelationVector) Format(f fmt.State, verb rune) {
+	if cv == nil {
+		fmt.Fprint(f, "<nil>")
+		return
+	}
+
+	switch verb {
+	case 'v':
+		if f.Flag('+') {
+			extension, immutable := unpackState(cv.state.Load())
+			fmt.Fprintf(f, "{base: %s, extension: %d, version: %s, immutable: %t}",
+				cv.baseVector, extension, cv.version, immutable)
+			return
+		}
+		fallthrough
+	case 's', 'q':
+		fmt.Fprintf(f, fmt.FormatString(f, verb), cv.Value())
+	default:
+		fmt.Fprintf(f, "%%!%c(*correlationvector.CorrelationVector=%s)", verb, cv.Value())
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestFormatVerbs(t *testing.T) {
+	vector, _ := Extend("tul4NUsfs9Cl7mOf.1")
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{"%v", "tul4NUsfs9Cl7mOf.1.0"},
+		{"%s", "tul4NUsfs9Cl7mOf.1.0"},
+		{"%q", "\"tul4NUsfs9Cl7mOf.1.0\""},
+		{"%24s", "    tul4NUsfs9Cl7mOf.1.0"},
+		{"%-24s|", "tul4NUsfs9Cl7mOf.1.0    |"},
+		{"%.16s", "tul4NUsfs9Cl7mOf"},
+		{"%+v", "{base: tul4NUsfs9Cl7mOf.1, extension: 0, version: V1, immutable: false}"},
+		{"%d", "%!d(*correlationvector.CorrelationVector=tul4NUsfs9Cl7mOf.1.0)"},
+	}
+
+	for _, test := range tests {
+		if actual := fmt.Sprintf(test.format, vector); actual != test.expected {
+			t.Errorf("Formatting with %s should result in %s, got %s", test.format, test.expected, actual)
+		}
+	}
+}
+
+func TestFormatNilCorrelationVector(t *testing.T) {
+	var vector *CorrelationVector
+	if actual := fmt.Sprintf("%v", vector); actual != "<nil>" {
+		t.Errorf("Formatting nil correlation vector should result in <nil>, got %s", actual)
+	}
+}
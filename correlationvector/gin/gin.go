@@ -0,0 +1,37 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package gin contains a gin middleware propagating CorrelationVectors.
+package gin
+
+import (
+	"github.com/Microsoft/CorrelationVector-Go/correlationvector"
+	"github.com/gin-gonic/gin"
+)
+
+// ContextKey is the key under which Middleware stores the correlation vector
+// in the gin context.
+const ContextKey string = "correlationvector"
+
+// Middleware extends the correlation vector of the inbound request, or
+// generates a new one when it is missing or invalid, stores it in both the gin
+// context and the request context, and sets its value on the response header.
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cv, err := correlationvector.FromHeader(c.Request.Header)
+		if err != nil {
+			cv = correlationvector.NewCorrelationVector()
+		}
+
+		c.Set(ContextKey, cv)
+		c.Request = c.Request.WithContext(correlationvector.NewContext(c.Request.Context(), cv))
+		c.Header(correlationvector.HeaderName, cv.Value())
+		c.Next()
+	}
+}
+
+// FromContext gets the correlation vector stored by Middleware in the gin context, if any.
+func FromContext(c *gin.Context) (*correlationvector.CorrelationVector, bool) {
+	cv, ok := c.Value(ContextKey).(*correlationvector.CorrelationVector)
+	return cv, ok && cv != nil
+}
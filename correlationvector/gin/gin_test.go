@@ -0,0 +1,48 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package gin contains a gin middleware propagating CorrelationVectors.
+package gin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Microsoft/CorrelationVector-Go/correlationvector"
+	"github.com/gin-gonic/gin"
+)
+
+func TestMiddleware(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Middleware())
+
+	var fromGin, fromRequest string
+	router.GET("/", func(c *gin.Context) {
+		if cv, ok := FromContext(c); ok {
+			fromGin = cv.Value()
+		}
+		if cv, ok := correlationvector.FromContext(c.Request.Context()); ok {
+			fromRequest = cv.Value()
+		}
+	})
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(correlationvector.HeaderName, "tul4NUsfs9Cl7mOf.1")
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+
+	if fromGin != "tul4NUsfs9Cl7mOf.1.0" || fromRequest != "tul4NUsfs9Cl7mOf.1.0" {
+		t.Errorf("Middleware should store tul4NUsfs9Cl7mOf.1.0 in both contexts, got %s and %s", fromGin, fromRequest)
+	}
+	if recorder.Header().Get(correlationvector.HeaderName) != "tul4NUsfs9Cl7mOf.1.0" {
+		t.Errorf("Middleware should set tul4NUsfs9Cl7mOf.1.0 on the response, got %s", recorder.Header().Get(correlationvector.HeaderName))
+	}
+
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Code != http.StatusOK || recorder.Header().Get(correlationvector.HeaderName) == "" {
+		t.Errorf("Middleware should generate a correlation vector when the header is missing")
+	}
+}
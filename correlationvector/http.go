@@ -0,0 +1,249 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptrace"
+	"net/textproto"
+	"net/url"
+	"strings"
+)
+
+// HeaderName is the name of the header carrying the correlation vector.
+const HeaderName string = "MS-CV"
+
+// QueryParameterName is the name of the query parameter carrying the
+// correlation vector, for clients which cannot set headers.
+const QueryParameterName string = "cv"
+
+// HeaderBytes gets the number of bytes the correlation vector takes in an
+// HTTP/1.1 request or response header, which is the header name, the ": "
+// separating it from the value and the value, excluding the line break. It is
+// computed from Len, without building the value.
+func (cv *CorrelationVector) HeaderBytes() int {
+	return len(HeaderName) + len(": ") + cv.Len()
+}
+
+// FromHeader creates a new correlation vector by extending the value found in
+// the header. An error is returned when the header is missing or invalid.
+func FromHeader(header http.Header) (*CorrelationVector, error) {
+	return extendHeader(header.Get(HeaderName))
+}
+
+// SetHeader increments the correlation vector and writes the value to the header.
+func (cv *CorrelationVector) SetHeader(header http.Header) {
+	header.Set(HeaderName, cv.Increment())
+}
+
+// FromMIMEHeader creates a new correlation vector by extending the value found
+// in the MIME header. An error is returned when the header is missing or invalid.
+func FromMIMEHeader(header textproto.MIMEHeader) (*CorrelationVector, error) {
+	return extendHeader(header.Get(HeaderName))
+}
+
+// SetMIMEHeader increments the correlation vector and writes the value to the MIME header.
+func (cv *CorrelationVector) SetMIMEHeader(header textproto.MIMEHeader) {
+	header.Set(HeaderName, cv.Increment())
+}
+
+// FromQuery creates a new correlation vector by extending the value found in
+// the query parameters, such as for browser navigations which cannot set the
+// header. The "+" a base may contain must be escaped as "%2B" in the URL, which
+// url.Values.Encode does, or it is decoded as a space; since a valid value has
+// no spaces, they are read back as "+". An error is returned when the
+// parameter is missing or invalid.
+func FromQuery(values url.Values) (*CorrelationVector, error) {
+	value := values.Get(QueryParameterName)
+	if value == "" {
+		return nil, errors.New("correlationvector: missing " + QueryParameterName + " query parameter")
+	}
+	return extendHeader(strings.ReplaceAll(value, " ", "+"))
+}
+
+// SetQuery increments the correlation vector and writes the value to the query
+// parameters. The value must be escaped when building the URL, such as with
+// url.Values.Encode, or created with WithAlphanumericBase to need no escaping.
+func (cv *CorrelationVector) SetQuery(values url.Values) {
+	values.Set(QueryParameterName, cv.Increment())
+}
+
+// InjectRequest returns a clone of the request with the header set to the
+// incremented value of the correlation vector found in the request context.
+// The request is returned unchanged when its context has no correlation vector.
+func InjectRequest(req *http.Request) *http.Request {
+	cv, ok := FromContext(req.Context())
+	if !ok {
+		return req
+	}
+
+	clone := req.Clone(req.Context())
+	cv.SetHeader(clone.Header)
+	return clone
+}
+
+// WithClientTrace returns a copy of the parent context with an
+// httptrace.ClientTrace which logs the value of the correlation vector carried
+// by the context with logf, or log.Printf when nil, when a connection is
+// requested, when it is obtained and when the request is written, for
+// per-connection diagnostics from requests made with the context. The trace is
+// composed with any trace already in the context. Its hooks are invoked by
+// http.Transport, so a custom Transport must delegate to an http.Transport and
+// pass the request context along for anything to be logged. The parent context
+// is returned unchanged when it has no correlation vector.
+func WithClientTrace(ctx context.Context, logf func(format string, args ...interface{})) context.Context {
+	cv, ok := FromContext(ctx)
+	if !ok {
+		return ctx
+	}
+	if logf == nil {
+		logf = log.Printf
+	}
+
+	return httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		GetConn: func(hostPort string) {
+			logf("%s=%s get connection to %s", HeaderName, cv.Value(), hostPort)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			logf("%s=%s got connection to %s, reused: %t", HeaderName, cv.Value(), info.Conn.RemoteAddr(), info.Reused)
+		},
+		WroteRequest: func(info httptrace.WroteRequestInfo) {
+			logf("%s=%s wrote request, error: %v", HeaderName, cv.Value(), info.Err)
+		},
+	})
+}
+
+// MiddlewareOption configures the behavior of MiddlewareWithOptions.
+type MiddlewareOption func(*middlewareOptions)
+
+type middlewareOptions struct {
+	generateIfMissing bool
+	reject            http.Handler
+}
+
+// WithGenerateIfMissing sets whether a new correlation vector is generated
+// when the inbound header is missing or invalid. It defaults to true.
+func WithGenerateIfMissing(generate bool) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		o.generateIfMissing = generate
+	}
+}
+
+// WithRejectInvalid sets the handler invoked when the inbound header is
+// missing or invalid and generation is turned off. It defaults to replying
+// with 400 Bad Request.
+func WithRejectInvalid(reject http.Handler) MiddlewareOption {
+	return func(o *middlewareOptions) {
+		if reject != nil {
+			o.reject = reject
+		}
+	}
+}
+
+// Middleware extends the correlation vector of the inbound request, or
+// generates a new one when it is missing or invalid, stores it in the request
+// context and sets its value on the response header.
+func Middleware(next http.Handler) http.Handler {
+	return MiddlewareWithOptions(next)
+}
+
+// MiddlewareWithOptions is like Middleware but configured by the given options.
+func MiddlewareWithOptions(next http.Handler, opts ...MiddlewareOption) http.Handler {
+	options := newMiddlewareOptions(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cv, ok := options.vector(w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set(HeaderName, cv.Value())
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), cv)))
+	})
+}
+
+// WrapHandlerFunc is like Middleware for a handler function, returning a
+// handler function which can be registered with http.HandleFunc directly.
+func WrapHandlerFunc(fn http.HandlerFunc, opts ...MiddlewareOption) http.HandlerFunc {
+	return MiddlewareWithOptions(fn, opts...).ServeHTTP
+}
+
+// TrailerMiddleware is like MiddlewareWithOptions but returns the correlation
+// vector as a response trailer, so that it reflects the increments made while
+// handling the request. In HTTP/1.1 trailers are only sent with chunked
+// responses, so the handler must not set Content-Length, and clients only see
+// the trailer after reading the whole body. Proxies may drop trailers.
+func TrailerMiddleware(next http.Handler, opts ...MiddlewareOption) http.Handler {
+	options := newMiddlewareOptions(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cv, ok := options.vector(w, r)
+		if !ok {
+			return
+		}
+
+		w.Header().Set("Trailer", HeaderName)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), cv)))
+		w.Header().Set(HeaderName, cv.Value())
+	})
+}
+
+// newMiddlewareOptions Creates the middleware options with the defaults overridden by the given options.
+func newMiddlewareOptions(opts []MiddlewareOption) middlewareOptions {
+	options := middlewareOptions{
+		generateIfMissing: true,
+		reject:            http.HandlerFunc(rejectBadRequest),
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+	return options
+}
+
+// vector Gets the correlation vector for the inbound request, rejecting the
+// request when there is none and generation is turned off.
+func (o *middlewareOptions) vector(w http.ResponseWriter, r *http.Request) (*CorrelationVector, bool) {
+	cv, err := FromHeader(r.Header)
+	if err != nil {
+		if !o.generateIfMissing {
+			o.reject.ServeHTTP(w, r)
+			return nil, false
+		}
+		cv = NewCorrelationVector()
+	}
+	return cv, true
+}
+
+// extendHeader Validates and extends the given inbound header value.
+func extendHeader(value string) (*CorrelationVector, error) {
+	if value == "" {
+		return nil, errors.New("correlationvector: missing " + HeaderName + " header")
+	}
+	value = trimBasePadding(value)
+	collapsed, ok := collapseTerminators(value)
+	if !ok {
+		return nil, fmt.Errorf("correlationvector: invalid correlation vector %s. too many terminators", value)
+	}
+	value = collapsed
+
+	version, err := inferVersion(value)
+	if err != nil {
+		return nil, err
+	}
+	unsealed, _ := TrimTerminator(value)
+	if err = validate(unsealed, version); err != nil {
+		return nil, err
+	}
+	return Extend(value)
+}
+
+// rejectBadRequest Replies to the request with 400 Bad Request.
+func rejectBadRequest(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+}
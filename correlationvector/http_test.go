@@ -0,0 +1,248 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMiddlewareExtendsInboundHeader(t *testing.T) {
+	var actual string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cv, ok := FromContext(r.Context()); ok {
+			actual = cv.Value()
+		}
+	}))
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(HeaderName, "tul4NUsfs9Cl7mOf.1")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if actual != "tul4NUsfs9Cl7mOf.1.0" {
+		t.Errorf("Middleware should store the extended vector tul4NUsfs9Cl7mOf.1.0 in context, got %s", actual)
+	}
+	if recorder.Header().Get(HeaderName) != "tul4NUsfs9Cl7mOf.1.0" {
+		t.Errorf("Middleware should set the extended vector on the response, got %s", recorder.Header().Get(HeaderName))
+	}
+}
+
+func TestMiddlewareGeneratesIfMissing(t *testing.T) {
+	called := false
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, called = FromContext(r.Context())
+	}))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	if !called {
+		t.Errorf("Middleware should store a generated vector in context when the header is missing")
+	}
+	if recorder.Header().Get(HeaderName) == "" {
+		t.Errorf("Middleware should set the generated vector on the response")
+	}
+}
+
+func TestWrapHandlerFunc(t *testing.T) {
+	var actual string
+	handler := WrapHandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if cv, ok := FromContext(r.Context()); ok {
+			actual = cv.Value()
+		}
+	})
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(HeaderName, "tul4NUsfs9Cl7mOf.1")
+	recorder := httptest.NewRecorder()
+	handler(recorder, request)
+
+	if actual != "tul4NUsfs9Cl7mOf.1.0" || recorder.Header().Get(HeaderName) != "tul4NUsfs9Cl7mOf.1.0" {
+		t.Errorf("Wrapped handler function should get and set the extended vector tul4NUsfs9Cl7mOf.1.0, got %s", actual)
+	}
+
+	recorder = httptest.NewRecorder()
+	handler(recorder, httptest.NewRequest("GET", "/", nil))
+	if recorder.Header().Get(HeaderName) == "" {
+		t.Errorf("Wrapped handler function should set a generated vector when the header is missing")
+	}
+}
+
+func TestMiddlewareWithOptionsRejectsInvalid(t *testing.T) {
+	handler := MiddlewareWithOptions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Handler should not be invoked for a rejected request")
+	}), WithGenerateIfMissing(false))
+
+	for _, value := range []string{"", "tul4NUsfs9Cl7mO.1", "tul4NUsfs9Cl7mOf.x"} {
+		request := httptest.NewRequest("GET", "/", nil)
+		request.Header.Set(HeaderName, value)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+
+		if recorder.Code != http.StatusBadRequest {
+			t.Errorf("Middleware should reply 400 for header %q, got %d", value, recorder.Code)
+		}
+	}
+}
+
+func TestMiddlewareWithOptionsCustomReject(t *testing.T) {
+	handler := MiddlewareWithOptions(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}),
+		WithGenerateIfMissing(false),
+		WithRejectInvalid(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		})))
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Middleware should invoke the rejection handler, got %d", recorder.Code)
+	}
+}
+
+func TestTrailerMiddlewareReflectsIncrements(t *testing.T) {
+	handler := TrailerMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cv, _ := FromContext(r.Context())
+		cv.Increment()
+		cv.Increment()
+		w.Write([]byte("ok"))
+	}))
+
+	request := httptest.NewRequest("GET", "/", nil)
+	request.Header.Set(HeaderName, "tul4NUsfs9Cl7mOf.1")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	response := recorder.Result()
+	if response.Header.Get(HeaderName) != "" {
+		t.Errorf("Trailer middleware should not set the header, got %s", response.Header.Get(HeaderName))
+	}
+	if response.Trailer.Get(HeaderName) != "tul4NUsfs9Cl7mOf.1.2" {
+		t.Errorf("Trailer middleware should set the trailer tul4NUsfs9Cl7mOf.1.2, got %s", response.Trailer.Get(HeaderName))
+	}
+}
+
+func TestSetHeaderIncrements(t *testing.T) {
+	vector, _ := Extend("tul4NUsfs9Cl7mOf.1")
+	header := http.Header{}
+	vector.SetHeader(header)
+
+	if header.Get(HeaderName) != "tul4NUsfs9Cl7mOf.1.1" {
+		t.Errorf("SetHeader should write the incremented vector tul4NUsfs9Cl7mOf.1.1, got %s", header.Get(HeaderName))
+	}
+}
+
+func TestInjectRequest(t *testing.T) {
+	vector, _ := Extend("tul4NUsfs9Cl7mOf.1")
+	request := httptest.NewRequest("GET", "/", nil)
+	request = request.WithContext(NewContext(request.Context(), vector))
+
+	injected := InjectRequest(request)
+	if injected.Header.Get(HeaderName) != "tul4NUsfs9Cl7mOf.1.1" {
+		t.Errorf("Injected request should carry the incremented vector tul4NUsfs9Cl7mOf.1.1, got %s", injected.Header.Get(HeaderName))
+	}
+	if request.Header.Get(HeaderName) != "" {
+		t.Errorf("Original request should not be modified, got %s", request.Header.Get(HeaderName))
+	}
+
+	request = httptest.NewRequest("GET", "/", nil)
+	if injected := InjectRequest(request); injected != request {
+		t.Errorf("Request without correlation vector in context should be returned unchanged")
+	}
+}
+
+func TestMIMEHeaderRoundTrip(t *testing.T) {
+	header := textproto.MIMEHeader{}
+	header.Set(HeaderName, "tul4NUsfs9Cl7mOf.1")
+
+	vector, err := FromMIMEHeader(header)
+	if err != nil || vector.Value() != "tul4NUsfs9Cl7mOf.1.0" {
+		t.Errorf("Vector from MIME header should be tul4NUsfs9Cl7mOf.1.0, got %v", err)
+		return
+	}
+
+	vector.SetMIMEHeader(header)
+	if header.Get(HeaderName) != "tul4NUsfs9Cl7mOf.1.1" {
+		t.Errorf("SetMIMEHeader should write the incremented vector tul4NUsfs9Cl7mOf.1.1, got %s", header.Get(HeaderName))
+	}
+	if http.Header(header).Get(HeaderName) != header.Get(HeaderName) {
+		t.Errorf("MIME header and HTTP header should share the canonical key")
+	}
+
+	if _, err := FromMIMEHeader(textproto.MIMEHeader{}); err == nil {
+		t.Errorf("Vector from empty MIME header should return error")
+	}
+}
+
+func TestHeaderBytes(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.2!")
+	var header bytes.Buffer
+	http.Header{HeaderName: {vector.Value()}}.Write(&header)
+	if vector.HeaderBytes() != header.Len()-len("\r\n") {
+		t.Errorf("Header bytes should be %d, got %d", header.Len()-len("\r\n"), vector.HeaderBytes())
+	}
+}
+
+func TestWithClientTrace(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	var logs []string
+	logf := func(format string, args ...interface{}) {
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+
+	vector, _ := Extend("tul4NUsfs9Cl7mOf.1")
+	ctx := WithClientTrace(NewContext(context.Background(), vector), logf)
+	request, _ := http.NewRequestWithContext(ctx, "GET", server.URL, nil)
+	response, err := server.Client().Do(InjectRequest(request))
+	if err != nil {
+		t.Errorf("Request with client trace should not return error, got %v", err)
+		return
+	}
+	response.Body.Close()
+
+	if len(logs) != 3 {
+		t.Errorf("Client trace should log 3 events, got %v", logs)
+	}
+	for _, line := range logs {
+		if !strings.Contains(line, "tul4NUsfs9Cl7mOf.1.1") {
+			t.Errorf("Client trace should log the current vector tul4NUsfs9Cl7mOf.1.1, got %s", line)
+		}
+	}
+
+	if ctx := context.Background(); WithClientTrace(ctx, logf) != ctx {
+		t.Errorf("Context without correlation vector should be returned unchanged")
+	}
+}
+
+func TestQueryRoundTrip(t *testing.T) {
+	vector, _ := Extend("KZY+dsX2jEaZesgCPjJ2Ng.1")
+	values := url.Values{}
+	vector.SetQuery(values)
+	if values.Get(QueryParameterName) != "KZY+dsX2jEaZesgCPjJ2Ng.1.1" {
+		t.Errorf("SetQuery should write the incremented vector KZY+dsX2jEaZesgCPjJ2Ng.1.1, got %s", values.Get(QueryParameterName))
+	}
+
+	for _, query := range []string{values.Encode(), "cv=KZY+dsX2jEaZesgCPjJ2Ng.1.1"} {
+		parsed, _ := url.ParseQuery(query)
+		vector, err := FromQuery(parsed)
+		if err != nil || vector.Value() != "KZY+dsX2jEaZesgCPjJ2Ng.1.1.0" {
+			t.Errorf("Vector from query %s should be KZY+dsX2jEaZesgCPjJ2Ng.1.1.0, got %v", query, err)
+		}
+	}
+
+	if _, err := FromQuery(url.Values{}); err == nil {
+		t.Errorf("Vector from empty query should return error")
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package logrus contains a logrus hook that enriches entries with CorrelationVectors.
+//
+// The hook reads the correlation vector from the context of the entry, so the
+// context has to be attached when logging:
+//
+//	logger.AddHook(&logrus.Hook{})
+//	logger.WithContext(ctx).Info("handled request")
+package logrus
+
+import (
+	"github.com/Microsoft/CorrelationVector-Go/correlationvector"
+	"github.com/sirupsen/logrus"
+)
+
+// FieldKey is the key of the field carrying the correlation vector.
+const FieldKey string = "cv"
+
+// Hook is a logrus.Hook adding the value of the correlation vector found in
+// the context of the entry as a field. Entries without a context or without a
+// correlation vector in it are left untouched.
+type Hook struct{}
+
+// Levels implements logrus.Hook and fires the hook on all levels.
+func (h *Hook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+// Fire implements logrus.Hook.
+func (h *Hook) Fire(entry *logrus.Entry) error {
+	if entry.Context == nil {
+		return nil
+	}
+	if cv, ok := correlationvector.FromContext(entry.Context); ok {
+		entry.Data[FieldKey] = cv.Value()
+	}
+	return nil
+}
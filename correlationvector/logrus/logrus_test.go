@@ -0,0 +1,35 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package logrus contains a logrus hook that enriches entries with CorrelationVectors.
+package logrus
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Microsoft/CorrelationVector-Go/correlationvector"
+	"github.com/sirupsen/logrus"
+)
+
+func TestHookAddsField(t *testing.T) {
+	var output bytes.Buffer
+	logger := logrus.New()
+	logger.Out = &output
+	logger.AddHook(&Hook{})
+
+	vector, _ := correlationvector.Extend("tul4NUsfs9Cl7mOf.1")
+	logger.WithContext(correlationvector.NewContext(context.Background(), vector)).Info("with cv")
+	if !strings.Contains(output.String(), "cv=tul4NUsfs9Cl7mOf.1.0") {
+		t.Errorf("Entry should carry the correlation vector, got %s", output.String())
+	}
+
+	output.Reset()
+	logger.WithContext(context.Background()).Info("without cv")
+	logger.Info("without context")
+	if strings.Contains(output.String(), "cv=") {
+		t.Errorf("Entry should not carry a correlation vector, got %s", output.String())
+	}
+}
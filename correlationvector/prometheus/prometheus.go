@@ -0,0 +1,100 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package prometheus contains a prometheus collector of CorrelationVector activity.
+package prometheus
+
+import (
+	"github.com/Microsoft/CorrelationVector-Go/correlationvector"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// VersionLabel is the label carrying the version of the correlation vectors,
+// such as "V1" or "V2", on every metric.
+const VersionLabel string = "version"
+
+// Collector is a prometheus.Collector exposing the following metrics about the
+// correlation vectors of the process, all labeled by version:
+//
+//   - correlationvector_increments_total counts the increments.
+//   - correlationvector_terminations_total counts the terminations.
+//   - correlationvector_spins_total counts the spins.
+//   - correlationvector_spin_wraps_total counts the wraps of the spin counter.
+//   - correlationvector_depth is a histogram of the depth of the incremented
+//     correlation vectors.
+type Collector struct {
+	increments   *prometheus.CounterVec
+	terminations *prometheus.CounterVec
+	spins        *prometheus.CounterVec
+	spinWraps    *prometheus.CounterVec
+	depth        *prometheus.HistogramVec
+}
+
+// NewCollector creates a collector and installs it on the OnIncrement,
+// OnTerminate, OnSpin and OnSpinWrap hooks of the correlationvector package,
+// calling the hooks that were set before. Since the hooks are global, a single
+// collector should be created per process, before correlation vectors are
+// used, and registered with a prometheus.Registerer.
+func NewCollector() *Collector {
+	c := &Collector{
+		increments:   newCounter("correlationvector_increments_total", "Number of increments of correlation vectors."),
+		terminations: newCounter("correlationvector_terminations_total", "Number of terminations of correlation vectors."),
+		spins:        newCounter("correlationvector_spins_total", "Number of spins of correlation vectors."),
+		spinWraps:    newCounter("correlationvector_spin_wraps_total", "Number of wraps of the spin counter of correlation vectors."),
+		depth: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "correlationvector_depth",
+			Help:    "Depth of the incremented correlation vectors.",
+			Buckets: prometheus.LinearBuckets(1, 1, 10),
+		}, []string{VersionLabel}),
+	}
+
+	correlationvector.OnIncrement = chain(correlationvector.OnIncrement, func(cv *correlationvector.CorrelationVector) {
+		c.increments.WithLabelValues(cv.Version().String()).Inc()
+		c.depth.WithLabelValues(cv.Version().String()).Observe(float64(cv.Depth()))
+	})
+	correlationvector.OnTerminate = chain(correlationvector.OnTerminate, c.observer(c.terminations))
+	correlationvector.OnSpin = chain(correlationvector.OnSpin, c.observer(c.spins))
+	correlationvector.OnSpinWrap = chain(correlationvector.OnSpinWrap, c.observer(c.spinWraps))
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.increments.Describe(ch)
+	c.terminations.Describe(ch)
+	c.spins.Describe(ch)
+	c.spinWraps.Describe(ch)
+	c.depth.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.increments.Collect(ch)
+	c.terminations.Collect(ch)
+	c.spins.Collect(ch)
+	c.spinWraps.Collect(ch)
+	c.depth.Collect(ch)
+}
+
+// observer Creates a hook incrementing the given counter.
+func (c *Collector) observer(counter *prometheus.CounterVec) func(cv *correlationvector.CorrelationVector) {
+	return func(cv *correlationvector.CorrelationVector) {
+		counter.WithLabelValues(cv.Version().String()).Inc()
+	}
+}
+
+// newCounter Creates a counter labeled by version.
+func newCounter(name string, help string) *prometheus.CounterVec {
+	return prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, []string{VersionLabel})
+}
+
+// chain Creates a hook calling the previous hook, if any, then the next one.
+func chain(previous, next func(cv *correlationvector.CorrelationVector)) func(cv *correlationvector.CorrelationVector) {
+	if previous == nil {
+		return next
+	}
+	return func(cv *correlationvector.CorrelationVector) {
+		previous(cv)
+		next(cv)
+	}
+}
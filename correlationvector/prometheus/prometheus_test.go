@@ -0,0 +1,49 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package prometheus contains a prometheus collector of CorrelationVector activity.
+package prometheus
+
+import (
+	"testing"
+
+	"github.com/Microsoft/CorrelationVector-Go/correlationvector"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	var previous int
+	correlationvector.OnTerminate = func(cv *correlationvector.CorrelationVector) { previous++ }
+	collector := NewCollector()
+	defer func() {
+		correlationvector.OnIncrement = nil
+		correlationvector.OnTerminate = nil
+		correlationvector.OnSpin = nil
+		correlationvector.OnSpinWrap = nil
+	}()
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(collector); err != nil {
+		t.Errorf("Registering the collector should not return error, got %v", err)
+	}
+
+	vector, _ := correlationvector.Parse("tul4NUsfs9Cl7mOf.1")
+	vector.Increment()
+	vector.Increment()
+	correlationvector.Spin(vector.Value())
+	vector.Terminate()
+
+	if actual := testutil.ToFloat64(collector.increments.WithLabelValues("V1")); actual != 2 {
+		t.Errorf("Collector should count 2 increments, got %v", actual)
+	}
+	if actual := testutil.ToFloat64(collector.spins.WithLabelValues("V1")); actual != 1 {
+		t.Errorf("Collector should count 1 spin, got %v", actual)
+	}
+	if actual := testutil.ToFloat64(collector.terminations.WithLabelValues("V1")); actual != 1 || previous != 1 {
+		t.Errorf("Collector should count 1 termination and call the previous hook, got %v and %d", actual, previous)
+	}
+	if count := testutil.CollectAndCount(collector, "correlationvector_depth"); count != 1 {
+		t.Errorf("Collector should expose the depth histogram, got %d series", count)
+	}
+}
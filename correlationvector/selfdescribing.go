@@ -0,0 +1,50 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// versionPrefixes are the prefixes carrying the version of self-describing values.
+var versionPrefixes = map[Version]string{
+	V1Version: "v1:",
+	V2Version: "v2:",
+}
+
+// SelfDescribingValue gets the value of the correlation vector like Value,
+// prefixed with its version as "v1:" or "v2:", so that receivers do not have to
+// infer the version from the length of the base. The prefix is not part of the
+// specification: peers following it reject or mangle such values, so the
+// encoding is only meaningful between services that agree on it, and Value must
+// be used with any other peer.
+func (cv *CorrelationVector) SelfDescribingValue() string {
+	return versionPrefixes[cv.version] + cv.Value()
+}
+
+// ParseSelfDescribing creates a new correlation vector by parsing a value
+// prefixed with its version, as returned by SelfDescribingValue, like Parse.
+// An error is returned when the base does not have the length of the version
+// of the prefix. A value without prefix is parsed like Parse, so that peers can
+// adopt the encoding one at a time.
+func ParseSelfDescribing(correlationVector string) (*CorrelationVector, error) {
+	for version, prefix := range versionPrefixes {
+		if !strings.HasPrefix(correlationVector, prefix) {
+			continue
+		}
+
+		cv, err := Parse(correlationVector[len(prefix):])
+		if err != nil {
+			return nil, err
+		}
+		if cv.version != version {
+			return nil, fmt.Errorf("correlationvector: invalid correlation vector %s. base length does not match %s", correlationVector, version)
+		}
+		return cv, nil
+	}
+
+	return Parse(correlationVector)
+}
@@ -0,0 +1,41 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"testing"
+)
+
+func TestSelfDescribingRoundTrip(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected string
+	}{
+		{"tul4NUsfs9Cl7mOf.1.2", "v1:tul4NUsfs9Cl7mOf.1.2"},
+		{"KZY+dsX2jEaZesgCPjJ2Ng.1!", "v2:KZY+dsX2jEaZesgCPjJ2Ng.1!"},
+	} {
+		vector, _ := Parse(test.value)
+		if vector.SelfDescribingValue() != test.expected {
+			t.Errorf("Self-describing value of %s should be %s, got %s", test.value, test.expected, vector.SelfDescribingValue())
+		}
+
+		parsed, err := ParseSelfDescribing(test.expected)
+		if err != nil || parsed.Value() != test.value || parsed.Version() != vector.Version() {
+			t.Errorf("Parsing self-describing %s should return %s, got %v", test.expected, test.value, err)
+		}
+	}
+}
+
+func TestParseSelfDescribing(t *testing.T) {
+	if vector, err := ParseSelfDescribing("tul4NUsfs9Cl7mOf.1"); err != nil || vector.Value() != "tul4NUsfs9Cl7mOf.1" {
+		t.Errorf("Parsing a value without prefix should parse it like Parse, got %v", err)
+	}
+
+	for _, value := range []string{"v2:tul4NUsfs9Cl7mOf.1", "v1:KZY+dsX2jEaZesgCPjJ2Ng.1", "v1:tul4NUsfs9Cl7mOf.x"} {
+		if _, err := ParseSelfDescribing(value); err == nil {
+			t.Errorf("Parsing self-describing %s should return error", value)
+		}
+	}
+}
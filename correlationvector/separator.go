@@ -0,0 +1,52 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseWithSeparator creates a new correlation vector by parsing its string
+// representation like Parse, for systems that separate the segments with
+// another character than ".". Since the separator may also appear in the base,
+// the base is located by the length of each version rather than by the first
+// separator, and must be followed by the separator and extensions made of
+// digits only. The value of the returned correlation vector uses ".".
+func ParseWithSeparator(correlationVector string, separator rune) (*CorrelationVector, error) {
+	if separator == '.' {
+		return Parse(correlationVector)
+	}
+	if (separator >= '0' && separator <= '9') || string(separator) == CVTerminator {
+		return nil, fmt.Errorf("correlationvector: invalid separator %q", separator)
+	}
+
+	sep := string(separator)
+	for baseLength := BaseLength; baseLength <= BaseLengthV2; baseLength++ {
+		if !isBaseLength(baseLength, V1Version) && !isBaseLength(baseLength, V2Version) {
+			continue
+		}
+		if len(correlationVector) <= baseLength || !strings.HasPrefix(correlationVector[baseLength:], sep) {
+			continue
+		}
+
+		extensions := correlationVector[baseLength+len(sep):]
+		unsealed, _ := TrimTerminator(extensions)
+		if !isDigits(strings.ReplaceAll(unsealed, sep, "")) {
+			continue
+		}
+		return Parse(correlationVector[:baseLength] + "." + strings.ReplaceAll(extensions, sep, "."))
+	}
+
+	return nil, fmt.Errorf("correlationvector: invalid correlation vector %s. no base followed by separator %q", correlationVector, separator)
+}
+
+// ValueWithSeparator gets the value of the correlation vector like Value, with
+// the segments separated by the given character instead of ".".
+func (cv *CorrelationVector) ValueWithSeparator(separator rune) string {
+	value := cv.Value()
+	p := strings.Index(value, ".")
+	return value[:p] + strings.ReplaceAll(value[p:], ".", string(separator))
+}
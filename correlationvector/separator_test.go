@@ -0,0 +1,48 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"testing"
+)
+
+func TestParseWithSeparator(t *testing.T) {
+	for _, test := range []struct {
+		value    string
+		expected string
+	}{
+		{"tul4NUsfs9Cl7mOf-1-2", "tul4NUsfs9Cl7mOf.1.2"},
+		{"tul4NUsfs9Cl7mOf-1-2!", "tul4NUsfs9Cl7mOf.1.2!"},
+		{"tul4-Usfs9Cl7mOf-1", "tul4-Usfs9Cl7mOf.1"},
+		{"KZY+dsX2jEaZ-sgCPjJ2Ng-3", "KZY+dsX2jEaZ-sgCPjJ2Ng.3"},
+		{"KZY+dsX2jEaZesgCPj-4", "KZY+dsX2jEaZesgCPj.4"},
+		{"tul4NUsfs9Cl7mOf.1.2", ""},
+	} {
+		vector, err := ParseWithSeparator(test.value, '-')
+		if test.expected == "" {
+			if err == nil {
+				t.Errorf("Parsing %s with separator - should return error, got %s", test.value, vector.Value())
+			}
+			continue
+		}
+		if err != nil || vector.Value() != test.expected {
+			t.Errorf("Parsing %s with separator - should return %s, got %v", test.value, test.expected, err)
+			continue
+		}
+		if vector.ValueWithSeparator('-') != test.value {
+			t.Errorf("Value with separator - should be %s, got %s", test.value, vector.ValueWithSeparator('-'))
+		}
+	}
+}
+
+func TestParseWithSeparatorDefault(t *testing.T) {
+	vector, err := ParseWithSeparator("tul4NUsfs9Cl7mOf.1.2", '.')
+	if err != nil || vector.Value() != "tul4NUsfs9Cl7mOf.1.2" {
+		t.Errorf("Parsing with separator . should behave like Parse, got %v", err)
+	}
+	if _, err = ParseWithSeparator("tul4NUsfs9Cl7mOf1112", '1'); err == nil {
+		t.Errorf("Parsing with a digit separator should return error")
+	}
+}
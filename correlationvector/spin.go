@@ -5,8 +5,13 @@
 package correlationvector
 
 import (
+	"encoding/json"
+	"fmt"
+	"math"
 	"math/rand"
 	"strconv"
+	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -69,6 +74,126 @@ type SpinParameters struct {
 	Entropy     SpinEntropy
 }
 
+// OnSpin is invoked, when set, with every correlation vector created by the
+// Spin operator, except when the spin terminates it instead.
+var OnSpin func(cv *CorrelationVector)
+
+// OnSpinWrap is invoked, when set, with a spun correlation vector whenever the
+// counter of its spin value wrapped back to zero since the previous spin with
+// the same interval and periodicity in this process. The counter is the part of
+// the spin value left of the entropy bits and wraps every 2^16, 2^24 or 2^32
+// intervals depending on the periodicity, so frequent wraps mean that the
+// periodicity is too short for the lifetime of the operations. A spin with
+// NoPeriodicity never wraps. Spins racing each other may report a wrap that
+// did not happen.
+var OnSpinWrap func(cv *CorrelationVector)
+
+// lastSpinCounters are the last counters plus one spun with each interval and
+// periodicity, or 0 when there was none, to detect wraps for OnSpinWrap.
+var lastSpinCounters [2][4]atomic.Uint64
+
+// UseMonotonicSpinClock indicates whether or not the Spin operator reads the
+// time from the monotonic clock, as elapsed since the package was initialized,
+// instead of from the wall clock. Steps of the wall clock, such as NTP
+// corrections, then never make spin values go backward within a process, but
+// the spin time drifts from the wall clock by the steps skipped. Values are
+// still only ordered across processes as far as their clocks agree, and a
+// restarted process starts again from the wall clock.
+var UseMonotonicSpinClock = false
+
+// spinClockStart is the time the monotonic spin clock counts from.
+var spinClockStart = time.Now()
+
+var spinIntervalNames = []string{"Coarse", "Fine"}
+
+var spinPeriodicityNames = []string{"None", "Short", "Medium", "Long"}
+
+// String gets the name of the spin counter interval.
+func (i SpinCounterInterval) String() string {
+	return spinName(spinIntervalNames, int(i))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (i SpinCounterInterval) MarshalText() ([]byte, error) {
+	if int(i) < 0 || int(i) >= len(spinIntervalNames) {
+		return nil, fmt.Errorf("correlationvector: invalid spin interval %d", int(i))
+	}
+	return []byte(i.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (i *SpinCounterInterval) UnmarshalText(text []byte) error {
+	value, err := parseSpinName(spinIntervalNames, "interval", string(text))
+	*i = SpinCounterInterval(value)
+	return err
+}
+
+// String gets the name of the spin counter periodicity.
+func (p SpinCounterPeriodicity) String() string {
+	return spinName(spinPeriodicityNames, int(p))
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p SpinCounterPeriodicity) MarshalText() ([]byte, error) {
+	if int(p) < 0 || int(p) >= len(spinPeriodicityNames) {
+		return nil, fmt.Errorf("correlationvector: invalid spin periodicity %d", int(p))
+	}
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (p *SpinCounterPeriodicity) UnmarshalText(text []byte) error {
+	value, err := parseSpinName(spinPeriodicityNames, "periodicity", string(text))
+	*p = SpinCounterPeriodicity(value)
+	return err
+}
+
+// spinParametersJSON is the JSON representation of SpinParameters.
+type spinParametersJSON struct {
+	Interval    SpinCounterInterval    `json:"interval"`
+	Periodicity SpinCounterPeriodicity `json:"periodicity"`
+	Entropy     SpinEntropy            `json:"entropy"`
+}
+
+// MarshalJSON implements json.Marshaler, writing the interval and periodicity
+// by name, e.g. {"interval":"Fine","periodicity":"Short","entropy":2}.
+func (sp SpinParameters) MarshalJSON() ([]byte, error) {
+	return json.Marshal(spinParametersJSON(sp))
+}
+
+// UnmarshalJSON implements json.Unmarshaler. Missing fields keep the values
+// used by Spin, and an unknown name or an entropy out of range is an error.
+func (sp *SpinParameters) UnmarshalJSON(data []byte) error {
+	parameters := spinParametersJSON(defaultParameters)
+	if err := json.Unmarshal(data, &parameters); err != nil {
+		return err
+	}
+	if parameters.Entropy < NoEntropy || parameters.Entropy > FourEntropy {
+		return fmt.Errorf("correlationvector: invalid spin entropy %d", int(parameters.Entropy))
+	}
+
+	*sp = SpinParameters(parameters)
+	return nil
+}
+
+// spinName Gets the name of the given spin parameter value.
+func spinName(names []string, value int) string {
+	if value < 0 || value >= len(names) {
+		return "Unknown(" + strconv.Itoa(value) + ")"
+	}
+	return names[value]
+}
+
+// parseSpinName Gets the spin parameter value of the given name.
+func parseSpinName(names []string, kind string, name string) (int, error) {
+	for i, n := range names {
+		if n == name {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("correlationvector: invalid spin %s %q", kind, name)
+}
+
 // Spin creates a new correlation vector by applying the Spin operator to an
 // existing value. This should be done at the entry point of an operation.
 func Spin(correlationVector string) (*CorrelationVector, error) {
@@ -77,55 +202,286 @@ func Spin(correlationVector string) (*CorrelationVector, error) {
 
 // SpinWithParameters creates a new correlation vector by applying the Spin
 // operator to an existing value. This should be done at the entry point of an operation.
+// Nil parameters mean the defaults used by Spin.
 func SpinWithParameters(correlationVector string, parameters *SpinParameters) (*CorrelationVector, error) {
+	cv, _, err := SpinWithParametersDetailed(correlationVector, parameters)
+	return cv, err
+}
+
+// SpinWithParametersDetailed is like SpinWithParameters but also returns the
+// spin value that was appended. The spin value is the current time in ticks of
+// 100 nanoseconds, shifted right by the bits dropped for the interval (24 for
+// CoarseInterval, 16 for FineInterval), followed by the random entropy bytes
+// and masked to the bits of the periodicity plus the entropy bits. Values wider
+// than 32 bits are appended as two segments, the high 32 bits first. The spin
+// value is 0 when the result is terminated instead. Nil parameters mean the
+// defaults used by Spin.
+func SpinWithParametersDetailed(correlationVector string, parameters *SpinParameters) (*CorrelationVector, uint64, error) {
+	if parameters == nil {
+		parameters = &defaultParameters
+	}
+	correlationVector = trimBasePadding(correlationVector)
 	if isImmutable(correlationVector) {
-		return Parse(correlationVector)
+		cv, err := Parse(correlationVector)
+		if cv != nil {
+			cv.origin = OriginExtended
+		}
+		return cv, 0, err
 	}
 
 	version, err := inferVersion(correlationVector)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	if ValidateCorrelationVectorDuringCreation {
 		if err = validate(correlationVector, version); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	return spin(correlationVector, version, 0, parameters)
+}
+
+// SpinIncrementingParent creates a new correlation vector like
+// SpinWithParameters, but increments the extension of the given correlation
+// vector first, so that the spin point is recorded in the parent's counter.
+// Spinning "base.N" results in "base.<N+1>.<spin>.0" instead of
+// "base.N.<spin>.0". If incrementing the extension reaches the max length, the
+// terminated parent is returned without spinning, like any spin of a terminated
+// correlation vector. Nil parameters mean the defaults used by Spin.
+func SpinIncrementingParent(correlationVector string, parameters *SpinParameters) (*CorrelationVector, error) {
+	correlationVector = trimBasePadding(correlationVector)
+	if isImmutable(correlationVector) {
+		cv, _, err := SpinWithParametersDetailed(correlationVector, parameters)
+		return cv, err
+	}
+
+	parent, err := Parse(correlationVector)
+	if err != nil {
+		return nil, err
+	}
+
+	if ValidateCorrelationVectorDuringCreation {
+		if err = validate(correlationVector, parent.version); err != nil {
 			return nil, err
 		}
 	}
 
+	parent.origin = OriginExtended
+	parent.Increment()
+	return parent.Spin(parameters)
+}
+
+// CanSpin checks whether the given correlation vector can be spun with the
+// given parameters without being terminated, that is whether appending the
+// largest spin value of the parameters and the trailing ".0" stays within the
+// max length of its version. Callers can then re-root instead of getting a
+// terminated correlation vector. It is false for a terminated correlation
+// vector or one of unknown version. Nil parameters mean the defaults used by
+// Spin.
+func CanSpin(correlationVector string, parameters *SpinParameters) bool {
+	correlationVector = trimBasePadding(correlationVector)
+	if parameters == nil {
+		parameters = &defaultParameters
+	}
+	if isImmutable(correlationVector) {
+		return false
+	}
+
+	version, err := inferVersion(correlationVector)
+	if err != nil {
+		return false
+	}
+	baseVector := correlationVector + "." + formatSpinValue(parameters.mask(), parameters)
+	return !isOversized(baseVector, 0, version.MaxLength())
+}
+
+// ExtendAndSpin creates a new correlation vector by extending an existing value
+// like Extend and spinning the result in a single call, as done at
+// asynchronous boundaries, so "base.1" results in "base.1.0.<spin>.0". The
+// spin value takes one or two segments depending on the parameters, and when
+// either step reaches the max length the terminated correlation vector is
+// returned instead, like Extend and Spin do. Nil parameters mean the defaults
+// used by Spin.
+func ExtendAndSpin(correlationVector string, parameters *SpinParameters) (*CorrelationVector, error) {
+	child, err := Extend(correlationVector)
+	if child == nil || child.IsImmutable() {
+		return child, err
+	}
+
+	spun, spinErr := child.Spin(parameters)
+	if spinErr != nil {
+		return nil, spinErr
+	}
+	spun.original = child.original
+	return spun, err
+}
+
+// Spin creates a new correlation vector by applying the Spin operator to the
+// value of this correlation vector, without parsing it again. Like the Spin
+// function, a terminated correlation vector is returned unchanged. Nil
+// parameters mean the defaults used by the Spin function.
+func (cv *CorrelationVector) Spin(parameters *SpinParameters) (*CorrelationVector, error) {
+	if cv.IsImmutable() {
+		return cv, nil
+	}
+	if parameters == nil {
+		parameters = &defaultParameters
+	}
+	spun, _, err := spin(cv.Value(), cv.version, cv.maxLength, parameters)
+	return spun, err
+}
+
+// spin Applies the Spin operator to the given cv string of the given version and
+// max length, where 0 means the max length of the version, returning the spin
+// value that was appended.
+func spin(correlationVector string, version Version, maxLength int, parameters *SpinParameters) (*CorrelationVector, uint64, error) {
 	entropy := make([]byte, int(parameters.Entropy))
 	if _, err := rand.Read(entropy); err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
 	// Ticks is defined as 100 nanoseconds.
-	ticks := time.Now().UnixNano() / 100
+	ticks := spinNow().UnixNano() / 100
 
 	value := uint64(ticks >> parameters.tickBitsToDrop())
 	for i := 0; i < int(parameters.Entropy); i++ {
 		value = (value << 8) | uint64(entropy[i])
 	}
 
-	// Generate a bitmask and mask the lower totalBits in the value.
-	// The mask is generated by (1 << totalBits) - 1. We need to handle the edge case
-	// when shifting 64 bits, as it wraps around.
-	mask := uint64(1) << parameters.totalBits()
-	if parameters.totalBits() == 64 {
-		mask = 0
+	value &= parameters.mask()
+
+	var baseVector = correlationVector + "." + formatSpinValue(value, parameters)
+	if isOversized(baseVector, 0, effectiveMaxLength(version, maxLength)) {
+		cv, err := terminate(correlationVector)
+		if cv != nil {
+			cv.origin = OriginExtended
+		}
+		return cv, 0, err
+	}
+
+	cv := &CorrelationVector{
+		baseVector: baseVector,
+		version:    version,
+		origin:     OriginExtended,
+		maxLength:  maxLength,
+	}
+	if OnSpin != nil {
+		OnSpin(cv)
+	}
+	if OnSpinWrap != nil && parameters.wrapped(value) {
+		OnSpinWrap(cv)
+	}
+	return cv, value, nil
+}
+
+// maxFlattenValues is the max number of values Flatten expands a correlation
+// vector into.
+const maxFlattenValues = 1 << 16
+
+// Flatten expands the correlation vector into the sequence of values a plain
+// increment path would have produced up to its current value, for systems that
+// do not understand spin. Every extension segment N contributes the values of
+// its N+1 increments, from 0 to N, while every spin segment is replaced by the
+// 0 a plain extension would have produced, which loses the spin value. The
+// spin segments cannot be told apart from extensions by their value, so they
+// are given by their indices, where the base is at index 0: a spin value wider
+// than 32 bits takes two segments. The sequence grows with the sum of the
+// extensions, so an error is returned instead of more than 65536 values, such
+// as when a spin segment is not given, and the last value keeps the
+// terminator, if any.
+//
+// For example, "base.1.2" flattens to base.0, base.1, base.1.0, base.1.1 and
+// base.1.2, while "base.0.<spin>.1" with the spin segment 2 flattens to base.0,
+// base.0.0, base.0.0.0 and base.0.0.1.
+func (cv *CorrelationVector) Flatten(spinSegments ...int) ([]string, error) {
+	segments := append(strings.Split(cv.baseVector, "."), strconv.Itoa(int(cv.Extension())))
+
+	lasts := make([]int, len(segments))
+	for _, i := range spinSegments {
+		if i <= 0 || i >= len(segments) {
+			return nil, fmt.Errorf("correlationvector: invalid spin segment %d of %s", i, cv.Value())
+		}
+		lasts[i] = -1
+	}
+	total := 0
+	for i := 1; i < len(segments); i++ {
+		if lasts[i] < 0 {
+			lasts[i] = 0
+		} else {
+			lasts[i], _ = strconv.Atoi(segments[i])
+		}
+		if total += lasts[i] + 1; total > maxFlattenValues {
+			return nil, fmt.Errorf("correlationvector: flattening %s exceeds %d values", cv.Value(), maxFlattenValues)
+		}
+	}
+
+	values := make([]string, 0, total)
+	prefix := segments[0]
+	for i := 1; i < len(segments); i++ {
+		for j := 0; j <= lasts[i]; j++ {
+			values = append(values, prefix+"."+strconv.Itoa(j))
+		}
+		prefix = values[len(values)-1]
+	}
+
+	if cv.IsImmutable() {
+		values[len(values)-1] += CVTerminator
+	}
+	return values, nil
+}
+
+// SpinTime recovers the approximate time at which the correlation vector was
+// spun with the given parameters, which must be the ones Spin was called with.
+// Since the counter of the spin value drops the lower bits of the time, the
+// time is only resolved to the interval, about 1.67 seconds for CoarseInterval
+// and 6.5 milliseconds for FineInterval. Since the counter wraps around, the
+// time is only resolved within one period, so the latest matching time not
+// after now is returned. The spin value is read from the value itself, so that
+// parsed correlation vectors work too, in the segment right before the last
+// extension, where Spin puts it, or the two segments for parameters wider than
+// 32 bits. The spin of a correlation vector extended since then is not found,
+// and any other value whose segments fit the parameters is read like a spin
+// value. It returns false when there are not enough segments, when they
+// do not fit the parameters, or with NoPeriodicity. Nil parameters mean the
+// defaults used by Spin.
+func (cv *CorrelationVector) SpinTime(parameters *SpinParameters) (time.Time, bool) {
+	if parameters == nil {
+		parameters = &defaultParameters
 	}
-	mask--
-	value &= mask
 
-	s := strconv.Itoa(int(value))
+	segments := 1
 	if parameters.totalBits() > 32 {
-		s = strconv.Itoa(int(value>>32)) + "." + s
+		segments = 2
+	}
+	entropyBits := uint(parameters.Entropy) * 8
+	parts := strings.Split(cv.baseVector, ".")
+	if len(parts) <= segments || parameters.totalBits() <= entropyBits {
+		return time.Time{}, false
+	}
+
+	var value uint64
+	for _, part := range parts[len(parts)-segments:] {
+		segment, err := strconv.ParseUint(part, 10, 32)
+		if err != nil {
+			return time.Time{}, false
+		}
+		value = value<<32 | segment
+	}
+	if value&^parameters.mask() != 0 {
+		return time.Time{}, false
 	}
 
-	var baseVector = correlationVector + "." + s
-	if isOversized(baseVector, 0, version) {
-		return Parse(correlationVector + CVTerminator)
+	// The period covers the bits of the counter and the bits dropped from the ticks.
+	periodBits := parameters.totalBits() - entropyBits + parameters.tickBitsToDrop()
+	period := int64(1) << periodBits
+	now := spinNow().UnixNano() / 100
+	ticks := now&^(period-1) | int64(value>>entropyBits)<<parameters.tickBitsToDrop()
+	if ticks > now {
+		ticks -= period
 	}
-	return newCorrelationVector(baseVector, 0, version, false), nil
+	return time.Unix(0, ticks*100), true
 }
 
 var defaultParameters = SpinParameters{CoarseInterval, ShortPeriodicity, TwoEntropy}
@@ -141,6 +497,47 @@ func (sp *SpinParameters) tickBitsToDrop() uint {
 	}
 }
 
+// spinNow Gets the current time for spin values, read from the monotonic clock
+// when UseMonotonicSpinClock is set.
+func spinNow() time.Time {
+	if UseMonotonicSpinClock {
+		return spinClockStart.Add(time.Since(spinClockStart))
+	}
+	return time.Now()
+}
+
+// formatSpinValue Formats the given spin value as one segment, or as two
+// segments with the high 32 bits first for values wider than 32 bits.
+func formatSpinValue(value uint64, parameters *SpinParameters) string {
+	if parameters.totalBits() > 32 {
+		return strconv.FormatUint(value>>32, 10) + "." + strconv.FormatUint(value&math.MaxUint32, 10)
+	}
+	return strconv.FormatUint(value, 10)
+}
+
+// wrapped Records the counter of the given spin value and checks whether it
+// is lower than the previous counter spun with the same parameters.
+func (sp *SpinParameters) wrapped(value uint64) bool {
+	if sp.Interval < 0 || int(sp.Interval) >= len(lastSpinCounters) || sp.Periodicity < 0 || int(sp.Periodicity) >= len(lastSpinCounters[0]) {
+		return false
+	}
+
+	counter := value>>(uint(sp.Entropy)*8) + 1
+	previous := lastSpinCounters[sp.Interval][sp.Periodicity].Swap(counter)
+	return previous != 0 && counter < previous
+}
+
+// mask Gets the bitmask of the lower totalBits of a spin value.
+func (sp *SpinParameters) mask() uint64 {
+	// The mask is generated by (1 << totalBits) - 1. We need to handle the edge case
+	// when shifting 64 bits, as it wraps around.
+	mask := uint64(1) << sp.totalBits()
+	if sp.totalBits() == 64 {
+		mask = 0
+	}
+	return mask - 1
+}
+
 func (sp *SpinParameters) totalBits() uint {
 	counterBits := uint(0)
 	switch sp.Periodicity {
@@ -5,6 +5,8 @@
 package correlationvector
 
 import (
+	"encoding/json"
+	"math"
 	"strconv"
 	"strings"
 	"testing"
@@ -55,3 +57,351 @@ func TestSpinOverMaxCVLengthV2(t *testing.T) {
 		t.Errorf("Termination should be applied for CV that goes beyond max length after spin operation")
 	}
 }
+
+func TestFlatten(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.2")
+	expected := []string{"tul4NUsfs9Cl7mOf.0", "tul4NUsfs9Cl7mOf.1", "tul4NUsfs9Cl7mOf.1.0", "tul4NUsfs9Cl7mOf.1.1", "tul4NUsfs9Cl7mOf.1.2"}
+	if actual, err := vector.Flatten(); err != nil || strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Errorf("Flattened vector should be %v, got %v and %v", expected, actual, err)
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.1!")
+	expected = []string{"tul4NUsfs9Cl7mOf.0", "tul4NUsfs9Cl7mOf.1!"}
+	if actual, err := vector.Flatten(); err != nil || strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Errorf("Flattened vector should be %v, got %v and %v", expected, actual, err)
+	}
+
+	for _, index := range []int{0, 3} {
+		if actual, err := vector.Flatten(index); err == nil {
+			t.Errorf("Flattening with the spin segment %d out of range should return error, got %v", index, actual)
+		}
+	}
+}
+
+func TestFlattenSpunCorrelationVector(t *testing.T) {
+	spinParameters := SpinParameters{CoarseInterval, LongPeriodicity, FourEntropy}
+	vector, _ := SpinWithParameters("tul4NUsfs9Cl7mOf.0", &spinParameters)
+	vector.Increment()
+
+	// The 64 bits spin value adds two spin segments, which both flatten to 0.
+	expected := []string{"tul4NUsfs9Cl7mOf.0", "tul4NUsfs9Cl7mOf.0.0", "tul4NUsfs9Cl7mOf.0.0.0", "tul4NUsfs9Cl7mOf.0.0.0.0", "tul4NUsfs9Cl7mOf.0.0.0.1"}
+	if actual, err := vector.Flatten(2, 3); err != nil || strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Errorf("Flattened vector should be %v, got %v and %v", expected, actual, err)
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.0.3299416239.0")
+	expected = []string{"tul4NUsfs9Cl7mOf.0", "tul4NUsfs9Cl7mOf.0.0", "tul4NUsfs9Cl7mOf.0.0.0"}
+	if actual, err := vector.Flatten(2); err != nil || strings.Join(actual, " ") != strings.Join(expected, " ") {
+		t.Errorf("Flattened parsed vector should be %v, got %v and %v", expected, actual, err)
+	}
+	if actual, err := vector.Flatten(); err == nil {
+		t.Errorf("Flattening a parsed vector without its spin segment should return error, got %d values", len(actual))
+	}
+}
+
+func TestSpinIntervalsAndPeriodicities(t *testing.T) {
+	coarse := SpinParameters{CoarseInterval, LongPeriodicity, NoEntropy}
+	fine := SpinParameters{FineInterval, ShortPeriodicity, NoEntropy}
+	if coarse.tickBitsToDrop() <= fine.tickBitsToDrop() {
+		t.Errorf("Coarse interval should drop more tick bits than fine interval")
+	}
+	if coarse.totalBits() <= fine.totalBits() {
+		t.Errorf("Long periodicity should store more bits than short periodicity")
+	}
+
+	coarseValues := make(map[uint64]bool)
+	fineValues := make(map[uint64]bool)
+	for i := 0; i < 3; i++ {
+		spin, _ := SpinWithParameters("tul4NUsfs9Cl7mOf.0", &coarse)
+		value, _ := strconv.ParseUint(strings.Split(spin.Value(), ".")[2], 10, 64)
+		coarseValues[value] = true
+
+		spin, _ = SpinWithParameters("tul4NUsfs9Cl7mOf.0", &fine)
+		value, _ = strconv.ParseUint(strings.Split(spin.Value(), ".")[2], 10, 64)
+		if value > math.MaxUint16 {
+			t.Errorf("Short periodicity spin value should fit in 16 bits, got %d", value)
+		}
+		fineValues[value] = true
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	// The fine counter moves every 6.5 milliseconds, the coarse one every 1.67 seconds.
+	if len(fineValues) != 3 {
+		t.Errorf("Fine interval spin values should change every spin, got %v", fineValues)
+	}
+	if len(coarseValues) > 2 {
+		t.Errorf("Coarse interval spin values should change at most once, got %v", coarseValues)
+	}
+}
+
+func TestSpinWideValueSegments(t *testing.T) {
+	spinParameters := SpinParameters{CoarseInterval, LongPeriodicity, FourEntropy}
+	spin, _ := SpinWithParameters("tul4NUsfs9Cl7mOf.0", &spinParameters)
+
+	// The cV after a Spin will look like <cvBase>.0.<spinHigh>.<spinLow>.0, where each part fits in 32 bits.
+	splitVector := strings.Split(spin.Value(), ".")
+	if len(splitVector) != 5 {
+		t.Errorf("64 bits spin value should be split in two segments, got %s", spin.Value())
+		return
+	}
+	for _, segment := range splitVector[2:4] {
+		if _, err := strconv.ParseUint(segment, 10, 32); err != nil {
+			t.Errorf("Spin segment should fit in 32 bits, got %s", segment)
+		}
+	}
+}
+
+func TestSpinParametersJSONRoundTrip(t *testing.T) {
+	var spinParameters SpinParameters
+	if err := json.Unmarshal([]byte(`{"interval":"Fine","periodicity":"Short","entropy":2}`), &spinParameters); err != nil {
+		t.Errorf("Unmarshaling spin parameters should not return error, got %v", err)
+	}
+	if spinParameters != (SpinParameters{FineInterval, ShortPeriodicity, TwoEntropy}) {
+		t.Errorf("Unmarshaled spin parameters should be Fine, Short, 2, got %v", spinParameters)
+	}
+
+	data, err := json.Marshal(SpinParameters{CoarseInterval, LongPeriodicity, FourEntropy})
+	if err != nil || string(data) != `{"interval":"Coarse","periodicity":"Long","entropy":4}` {
+		t.Errorf("Marshaling spin parameters should result in names, got %s (%v)", data, err)
+	}
+}
+
+func TestSpinParametersJSONInvalid(t *testing.T) {
+	for _, data := range []string{
+		`{"interval":"Medium"}`,
+		`{"periodicity":"Forever"}`,
+		`{"entropy":5}`,
+		`{"interval":1}`,
+	} {
+		var spinParameters SpinParameters
+		if err := json.Unmarshal([]byte(data), &spinParameters); err == nil {
+			t.Errorf("Unmarshaling %s should return error", data)
+		}
+	}
+
+	if _, err := json.Marshal(SpinParameters{Interval: SpinCounterInterval(7)}); err == nil {
+		t.Errorf("Marshaling an unknown interval should return error")
+	}
+}
+
+func TestSpinMethod(t *testing.T) {
+	vector, _ := Extend("tul4NUsfs9Cl7mOf.1")
+	spinParameters := SpinParameters{FineInterval, ShortPeriodicity, TwoEntropy}
+	spin, err := vector.Spin(&spinParameters)
+	if err != nil {
+		t.Errorf("Spinning vector should not return error, got %v", err)
+		return
+	}
+
+	// The cV after a Spin will look like <cvBase>.1.0.<spinValue>.0.
+	splitVector := strings.Split(spin.Value(), ".")
+	if len(splitVector) != 5 || strings.Join(splitVector[:3], ".") != "tul4NUsfs9Cl7mOf.1.0" || splitVector[4] != "0" {
+		t.Errorf("Spun vector should look like tul4NUsfs9Cl7mOf.1.0.<spinValue>.0, got %s", spin.Value())
+	}
+	if spin, _ := vector.Spin(nil); len(strings.Split(spin.Value(), ".")) != 5 {
+		t.Errorf("Spinning vector with default parameters should add one spin segment, got %s", spin.Value())
+	}
+}
+
+func TestSpinMethodImmutable(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.0!")
+	if spin, err := vector.Spin(nil); spin != vector || err != nil {
+		t.Errorf("Spinning terminated vector should return it unchanged, got %s", spin.Value())
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23")
+	if spin, _ := vector.Spin(nil); spin.Value() != vector.Value()+CVTerminator {
+		t.Errorf("Termination should be applied for CV that goes beyond max length after spin operation, got %s", spin.Value())
+	}
+}
+
+func TestSpinWithParametersDetailed(t *testing.T) {
+	for _, spinParameters := range []SpinParameters{
+		{FineInterval, ShortPeriodicity, TwoEntropy},
+		{CoarseInterval, LongPeriodicity, FourEntropy},
+	} {
+		spin, value, err := SpinWithParametersDetailed("tul4NUsfs9Cl7mOf.0", &spinParameters)
+		if err != nil {
+			t.Errorf("Spinning vector should not return error, got %v", err)
+			continue
+		}
+
+		expected := strconv.FormatUint(value, 10)
+		if spinParameters.totalBits() > 32 {
+			expected = strconv.FormatUint(value>>32, 10) + "." + strconv.FormatUint(value&math.MaxUint32, 10)
+		}
+		if spin.Value() != "tul4NUsfs9Cl7mOf.0."+expected+".0" {
+			t.Errorf("Spun vector should carry the spin value %s, got %s", expected, spin.Value())
+		}
+	}
+
+	var baseVector = "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23"
+	if spin, value, _ := SpinWithParametersDetailed(baseVector, &defaultParameters); value != 0 || spin.Value() != baseVector+CVTerminator {
+		t.Errorf("Terminated spin should have spin value 0, got %d", value)
+	}
+}
+
+func TestSpinIncrementingParent(t *testing.T) {
+	spinParameters := SpinParameters{FineInterval, ShortPeriodicity, NoEntropy}
+	plain, _ := SpinWithParameters("tul4NUsfs9Cl7mOf.3", &spinParameters)
+	spin, err := SpinIncrementingParent("tul4NUsfs9Cl7mOf.3", &spinParameters)
+	if err != nil {
+		t.Errorf("Spinning vector should not return error, got %v", err)
+		return
+	}
+
+	plainSegments := strings.Split(plain.Value(), ".")
+	segments := strings.Split(spin.Value(), ".")
+	if len(segments) != len(plainSegments) || segments[1] != "4" || plainSegments[1] != "3" || segments[3] != "0" {
+		t.Errorf("Spinning vector incrementing the parent should be tul4NUsfs9Cl7mOf.4.<spin>.0, got %s (plain spin %s)", spin.Value(), plain.Value())
+	}
+
+	var baseVector = "tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.21474836479.9"
+	if spin, _ = SpinIncrementingParent(baseVector, nil); spin.Value() != baseVector+CVTerminator {
+		t.Errorf("Spinning vector incrementing the parent past max should return %s!, got %s", baseVector, spin.Value())
+	}
+}
+
+func TestCanSpin(t *testing.T) {
+	for _, test := range []struct {
+		value      string
+		parameters *SpinParameters
+		expected   bool
+	}{
+		{"tul4NUsfs9Cl7mOf.1", nil, true},
+		{"tul4NUsfs9Cl7mOf.1!", nil, false},
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23", nil, false},
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.2", &SpinParameters{FineInterval, NoPeriodicity, NoEntropy}, true},
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.2", &SpinParameters{CoarseInterval, LongPeriodicity, FourEntropy}, false},
+		{"tul4NUsfs9Cl7m.1", nil, false},
+	} {
+		if CanSpin(test.value, test.parameters) != test.expected {
+			t.Errorf("Whether %s can be spun should be %t", test.value, test.expected)
+		}
+		if test.parameters == nil {
+			test.parameters = &defaultParameters
+		}
+		if spin, err := SpinWithParameters(test.value, test.parameters); test.expected && (err != nil || spin.IsImmutable()) {
+			t.Errorf("Spinning %s should not terminate it when it can be spun", test.value)
+		}
+	}
+}
+
+func TestOnSpinWrap(t *testing.T) {
+	var wraps int
+	OnSpinWrap = func(cv *CorrelationVector) { wraps++ }
+	defer func() { OnSpinWrap = nil }()
+
+	spinParameters := SpinParameters{FineInterval, ShortPeriodicity, OneEntropy}
+	lastSpinCounters[FineInterval][ShortPeriodicity].Store(0)
+	if spinParameters.wrapped(0x100) || spinParameters.wrapped(0xFFFF00) {
+		t.Errorf("Increasing spin counters should not be reported as wraps")
+	}
+	if !spinParameters.wrapped(0x0001FF) {
+		t.Errorf("A spin counter lower than the previous one should be reported as a wrap")
+	}
+
+	lastSpinCounters[FineInterval][ShortPeriodicity].Store(math.MaxUint64)
+	if _, err := SpinWithParameters("tul4NUsfs9Cl7mOf.1", &spinParameters); err != nil || wraps != 1 {
+		t.Errorf("OnSpinWrap should be invoked once when the spin counter wraps, got %d", wraps)
+	}
+}
+
+func TestSpinTime(t *testing.T) {
+	for _, spinParameters := range []SpinParameters{
+		{FineInterval, ShortPeriodicity, TwoEntropy},
+		{CoarseInterval, MediumPeriodicity, NoEntropy},
+		{FineInterval, LongPeriodicity, FourEntropy},
+	} {
+		before := time.Now()
+		spin, _ := SpinWithParameters("tul4NUsfs9Cl7mOf.1", &spinParameters)
+		spin.Increment()
+		parsed, _ := Parse(spin.Value())
+
+		resolution := time.Duration(100 << spinParameters.tickBitsToDrop())
+		for _, vector := range []*CorrelationVector{spin, parsed} {
+			spunAt, ok := vector.SpinTime(&spinParameters)
+			if !ok || spunAt.After(before.Add(resolution)) || spunAt.Before(before.Add(-resolution)) {
+				t.Errorf("Spin time of %s should be within %s of %s, got %s", vector.Value(), resolution, before, spunAt)
+			}
+		}
+	}
+
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1")
+	if _, ok := vector.SpinTime(nil); ok {
+		t.Errorf("Spin time of a vector without spin segment should not be found")
+	}
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.1.16777216.0")
+	if _, ok := vector.SpinTime(&SpinParameters{CoarseInterval, MediumPeriodicity, NoEntropy}); ok {
+		t.Errorf("Spin time of a vector whose spin segment does not fit the parameters should not be found")
+	}
+	spinParameters := SpinParameters{FineInterval, NoPeriodicity, TwoEntropy}
+	spin, _ := SpinWithParameters("tul4NUsfs9Cl7mOf.1", &spinParameters)
+	if _, ok := spin.SpinTime(&spinParameters); ok {
+		t.Errorf("Spin time of a vector spun without periodicity should not be found")
+	}
+}
+
+func TestOnSpin(t *testing.T) {
+	var spins []string
+	OnSpin = func(cv *CorrelationVector) { spins = append(spins, cv.Value()) }
+	defer func() { OnSpin = nil }()
+
+	spin, _ := Spin("tul4NUsfs9Cl7mOf.1")
+	Spin("tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23")
+	if len(spins) != 1 || spins[0] != spin.Value() {
+		t.Errorf("OnSpin should be invoked with the spun vector only, got %v", spins)
+	}
+}
+
+func TestExtendAndSpin(t *testing.T) {
+	spin, err := ExtendAndSpin("tul4NUsfs9Cl7mOf.1", nil)
+	segments := strings.Split(spin.Value(), ".")
+	if err != nil || len(segments) != 5 || segments[1] != "1" || segments[2] != "0" || segments[4] != "0" {
+		t.Errorf("Extending and spinning tul4NUsfs9Cl7mOf.1 should return tul4NUsfs9Cl7mOf.1.0.<spin>.0, got %s and %v", spin.Value(), err)
+	}
+	if spin.Original() != "tul4NUsfs9Cl7mOf.1" {
+		t.Errorf("Extended and spun vector should keep the original value, got %s", spin.Original())
+	}
+
+	for _, baseVector := range []string{
+		"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23",
+		"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.2147483",
+	} {
+		if spin, _ = ExtendAndSpin(baseVector, nil); !spin.IsImmutable() || !strings.HasPrefix(spin.Value(), baseVector) {
+			t.Errorf("Extending and spinning %s past max should terminate it, got %s", baseVector, spin.Value())
+		}
+	}
+}
+
+func TestUseMonotonicSpinClock(t *testing.T) {
+	UseMonotonicSpinClock = true
+	defer func() { UseMonotonicSpinClock = false }()
+
+	if now := spinNow(); now.Sub(time.Now()).Abs() > time.Second {
+		t.Errorf("Monotonic spin clock should be close to the wall clock, got %s", now)
+	}
+
+	params := &SpinParameters{FineInterval, LongPeriodicity, NoEntropy}
+	var last uint64
+	for i := 0; i < 100; i++ {
+		_, value, err := SpinWithParametersDetailed("tul4NUsfs9Cl7mOf.1", params)
+		if err != nil || value < last {
+			t.Errorf("Spin values of the monotonic spin clock should not go backward, got %d after %d", value, last)
+		}
+		last = value
+	}
+}
+
+func TestSpinWithNilParameters(t *testing.T) {
+	for _, fn := range []func(string, *SpinParameters) (*CorrelationVector, error){SpinWithParameters, func(value string, parameters *SpinParameters) (*CorrelationVector, error) {
+		cv, _, err := SpinWithParametersDetailed(value, parameters)
+		return cv, err
+	}} {
+		vector, err := fn("tul4NUsfs9Cl7mOf.1", nil)
+		if err != nil || len(strings.Split(vector.Value(), ".")) != 4 {
+			t.Errorf("Spinning with nil parameters should use the defaults, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+// CVStats is a summary of the metadata of a correlation vector, for a single
+// debug log line.
+type CVStats struct {
+	Version           Version `json:"version"`
+	BaseLength        int     `json:"baseLength"`
+	Depth             int     `json:"depth"`
+	Length            int     `json:"length"`
+	Immutable         bool    `json:"immutable"`
+	RemainingCapacity int     `json:"remainingCapacity"`
+}
+
+// Stats gets the metadata of the correlation vector without building its
+// value. The remaining capacity is the number of characters left before its
+// max length is reached, or 0 once it is terminated.
+func (cv *CorrelationVector) Stats() CVStats {
+	stats := CVStats{
+		Version:    cv.Version(),
+		BaseLength: len(baseOf(cv.baseVector)),
+		Depth:      cv.Depth(),
+		Length:     cv.Len(),
+		Immutable:  cv.IsImmutable(),
+	}
+
+	if maxLen := cv.maxVectorLength(); !stats.Immutable && maxLen > stats.Length {
+		stats.RemainingCapacity = maxLen - stats.Length
+	}
+	return stats
+}
+
+// LogFields gets the correlation vector decomposed into fields for structured
+// logging, with the same keys across services:
+//
+//   - "cv" is the value.
+//   - "cv_base" is the base.
+//   - "cv_depth" is the depth, as an int.
+//   - "cv_version" is the name of the version, such as "V2".
+//   - "cv_immutable" is whether it is terminated, as a bool.
+func (cv *CorrelationVector) LogFields() map[string]interface{} {
+	return map[string]interface{}{
+		"cv":           cv.Value(),
+		"cv_base":      baseOf(cv.baseVector),
+		"cv_depth":     cv.Depth(),
+		"cv_version":   cv.Version().String(),
+		"cv_immutable": cv.IsImmutable(),
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestStats(t *testing.T) {
+	vector, _ := Parse("tul4NUsfs9Cl7mOf.1.2")
+	expected := CVStats{V1Version, 16, 2, 20, false, 43}
+	if stats := vector.Stats(); stats != expected {
+		t.Errorf("Stats of tul4NUsfs9Cl7mOf.1.2 should be %+v, got %+v", expected, stats)
+	}
+
+	vector, _ = Parse("tul4NUsfs9Cl7mOf.1.2!")
+	expected = CVStats{V1Version, 16, 2, 21, true, 0}
+	if stats := vector.Stats(); stats != expected {
+		t.Errorf("Stats of tul4NUsfs9Cl7mOf.1.2! should be %+v, got %+v", expected, stats)
+	}
+}
+
+func TestStatsJSON(t *testing.T) {
+	vector, _ := Parse("KZY+dsX2jEaZesgCPjJ2Ng.1")
+	data, err := json.Marshal(vector.Stats())
+	if err != nil {
+		t.Errorf("Marshalling stats should not return error, got %v", err)
+	}
+	if string(data) != `{"version":2,"baseLength":22,"depth":1,"length":24,"immutable":false,"remainingCapacity":103}` {
+		t.Errorf("Stats should be marshalled with their JSON names, got %s", data)
+	}
+}
+
+func TestLogFields(t *testing.T) {
+	vector, _ := Parse("KZY+dsX2jEaZesgCPjJ2Ng.1.2!")
+	expected := map[string]interface{}{
+		"cv":           "KZY+dsX2jEaZesgCPjJ2Ng.1.2!",
+		"cv_base":      "KZY+dsX2jEaZesgCPjJ2Ng",
+		"cv_depth":     2,
+		"cv_version":   "V2",
+		"cv_immutable": true,
+	}
+	if fields := vector.LogFields(); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("Log fields should be %v, got %v", expected, fields)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+// BaseTemplate is an inbound correlation vector value validated once, to
+// extend it repeatedly without parsing it again, such as for producers which
+// always extend from the same value. A template is immutable once created, so
+// Fork is safe to call concurrently.
+type BaseTemplate struct {
+	value   string
+	version Version
+}
+
+// NewBaseTemplate creates a template for extending the given value of the given
+// version. An error is returned when the value is invalid for the version, and
+// ErrTooLong when it is terminated or cannot be extended without reaching the
+// max length of the version.
+func NewBaseTemplate(base string, version Version) (*BaseTemplate, error) {
+	base = trimBasePadding(base)
+	if isImmutable(base) {
+		return nil, ErrTooLong
+	}
+	if err := validate(base, version); err != nil {
+		return nil, err
+	}
+	if isOversized(base, 0, version.MaxLength()) {
+		return nil, ErrTooLong
+	}
+	return &BaseTemplate{value: base, version: version}, nil
+}
+
+// Fork creates a new correlation vector by extending the value of the template
+// like Extend, such as "base.1" becoming "base.1.0", without inferring the
+// version or validating the value again.
+func (t *BaseTemplate) Fork() *CorrelationVector {
+	return &CorrelationVector{
+		baseVector: t.value,
+		version:    t.version,
+		original:   t.value,
+		origin:     OriginExtended,
+	}
+}
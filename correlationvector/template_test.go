@@ -0,0 +1,61 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package correlationvector contains library functions to manipulate CorrelationVectors.
+package correlationvector
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBaseTemplateFork(t *testing.T) {
+	template, err := NewBaseTemplate("tul4NUsfs9Cl7mOf.1", V1Version)
+	if err != nil {
+		t.Errorf("Template of a valid cv should not return error, got %v", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	forks := make([]*CorrelationVector, 10)
+	for i := range forks {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			forks[i] = template.Fork()
+			forks[i].Increment()
+		}(i)
+	}
+	wg.Wait()
+
+	expected, _ := Extend("tul4NUsfs9Cl7mOf.1")
+	expected.Increment()
+	for _, fork := range forks {
+		if fork.Value() != expected.Value() || fork.Version() != V1Version || fork.Original() != "tul4NUsfs9Cl7mOf.1" {
+			t.Errorf("Incremented fork should be %s, got %s", expected.Value(), fork.Value())
+		}
+	}
+}
+
+func TestNewBaseTemplateInvalid(t *testing.T) {
+	for _, test := range []struct {
+		value   string
+		version Version
+	}{
+		{"tul4NUsfs9Cl7mOf.1", V2Version},
+		{"tul4NUsfs9Cl7mOf.x", V1Version},
+		{"tul4NUsfs9Cl7mOf.1!", V1Version},
+		{"tul4NUsfs9Cl7mOf.2147483647.2147483647.2147483647.214748364.23", V1Version},
+	} {
+		if _, err := NewBaseTemplate(test.value, test.version); err == nil {
+			t.Errorf("Template of %s as %s should return error", test.value, test.version)
+		}
+	}
+}
+
+func BenchmarkBaseTemplateFork(b *testing.B) {
+	template, _ := NewBaseTemplate("KZY+dsX2jEaZesgCPjJ2Ng.1.2", V2Version)
+	for i := 0; i < b.N; i++ {
+		template.Fork()
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package zap contains helpers to attach CorrelationVectors to zap loggers.
+package zap
+
+import (
+	"context"
+
+	"github.com/Microsoft/CorrelationVector-Go/correlationvector"
+	"go.uber.org/zap"
+)
+
+// FieldKey is the key of the field carrying the correlation vector.
+const FieldKey string = "cv"
+
+// Field creates a field carrying the value of the correlation vector. A nil
+// correlation vector results in a field that is skipped.
+func Field(cv *correlationvector.CorrelationVector) zap.Field {
+	if cv == nil {
+		return zap.Skip()
+	}
+	return zap.String(FieldKey, cv.Value())
+}
+
+// FieldFromContext creates a field carrying the value of the correlation
+// vector found in the context, or a field that is skipped when there is none.
+func FieldFromContext(ctx context.Context) zap.Field {
+	cv, _ := correlationvector.FromContext(ctx)
+	return Field(cv)
+}
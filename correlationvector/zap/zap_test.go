@@ -0,0 +1,26 @@
+// Copyright (c) Microsoft Corporation. All rights reserved.
+// Licensed under the MIT License.
+
+// Package zap contains helpers to attach CorrelationVectors to zap loggers.
+package zap
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Microsoft/CorrelationVector-Go/correlationvector"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestFieldFromContext(t *testing.T) {
+	vector, _ := correlationvector.Extend("tul4NUsfs9Cl7mOf.1")
+	field := FieldFromContext(correlationvector.NewContext(context.Background(), vector))
+	if field.Key != FieldKey || field.String != "tul4NUsfs9Cl7mOf.1.0" {
+		t.Errorf("Field should carry tul4NUsfs9Cl7mOf.1.0 under key %s, got %s=%s", FieldKey, field.Key, field.String)
+	}
+
+	field = FieldFromContext(context.Background())
+	if field.Type != zapcore.SkipType {
+		t.Errorf("Field should be skipped when the context has no correlation vector")
+	}
+}